@@ -56,6 +56,10 @@ func NewCNFCommand(ctx context.Context) *cobra.Command {
 				return utilerrors.NewAggregate(errs)
 			}
 
+			if o.Cleanup {
+				return cnf.Cleanup(o)
+			}
+
 			cm, err := cnf.NewCNFManager(o)
 			if err != nil {
 				return err
@@ -27,6 +27,8 @@ var (
 // Adds the list of known types to Scheme.
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
+		&ClusterSet{},
+		&ClusterSetList{},
 		&Peer{},
 		&PeerList{},
 	)
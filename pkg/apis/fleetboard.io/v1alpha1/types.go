@@ -5,13 +5,15 @@ import (
 )
 
 // +genclient
-// +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:resource:scope="Namespaced",shortName=peer;peers,categories=fleetboard
+// +kubebuilder:subresource:status
 type Peer struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 	Spec              PeerSpec `json:"spec"`
+	// +optional
+	Status PeerStatus `json:"status,omitempty"`
 }
 
 type PeerSpec struct {
@@ -23,10 +25,71 @@ type PeerSpec struct {
 	Port      int      `json:"port"`
 	PublicKey string   `json:"public_key"` // wire-guard public key
 	IsHub     bool     `json:"ishub"`
+	// wire-guard public key published ahead of a key rotation, other clusters add it before it's switched to.
+	// +optional
+	NextPublicKey string `json:"nextPublicKey,omitempty"`
+	// public key other clusters derive the pre-shared key of their pair from, empty if the peer doesn't use
+	// pre-shared keys.
+	// +optional
+	PresharedKeyExchange string `json:"presharedKeyExchange,omitempty"`
 	// the peer will be public and will be connected directly by other cluster.
 	// isPublic is true only works when `endpoint` is not empty.
 	// +optional
 	IsPublic bool `json:"isPublic"`
+	// transport the peer serves when udp is blocked, tcp or wss, empty means udp only.
+	// +kubebuilder:validation:Enum="";tcp;wss
+	// +optional
+	FallbackTransport string `json:"fallbackTransport,omitempty"`
+	// port of the fallback transport on endpoint.
+	// +optional
+	FallbackPort int `json:"fallbackPort,omitempty"`
+	// gateways carrying traffic of the cluster along with the one above, other clusters keep a tunnel with
+	// each of them and route the cluster cidr through one of them.
+	// +optional
+	Gateways []GatewaySpec `json:"gateways,omitempty"`
+}
+
+// GatewaySpec is an additional cnf pod holding inter cluster tunnels of its cluster.
+type GatewaySpec struct {
+	// name of the node the gateway runs on.
+	Name string `json:"name"`
+	// node address of the gateway, empty if the cluster is not public.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// +optional
+	Port      int    `json:"port,omitempty"`
+	PublicKey string `json:"public_key"` // wire-guard public key
+	// wire-guard public key published ahead of a key rotation.
+	// +optional
+	NextPublicKey string `json:"nextPublicKey,omitempty"`
+}
+
+// Condition types of a peer tunnel.
+const (
+	// PeerConditionConnected means the wire-guard handshake with the peer is recent enough.
+	PeerConditionConnected = "Connected"
+	// PeerConditionHandshakeStale means the peer has shaken hands before, but not recently.
+	PeerConditionHandshakeStale = "HandshakeStale"
+)
+
+// PeerStatus is the tunnel health of a peer observed by the hub cnf leader.
+type PeerStatus struct {
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// last time a wire-guard handshake with the peer completed.
+	// +optional
+	LastHandshakeTime *metav1.Time `json:"lastHandshakeTime,omitempty"`
+	// +optional
+	ReceiveBytes int64 `json:"rxBytes,omitempty"`
+	// +optional
+	TransmitBytes int64 `json:"txBytes,omitempty"`
+	// remote address the peer is really sending from, may differ from spec endpoint behind NAT.
+	// +optional
+	ObservedEndpoint string `json:"observedEndpoint,omitempty"`
+	// cluster ids the peer has a live tunnel with, written by the peer itself. Other clusters may relay through
+	// it when hub is unreachable.
+	// +optional
+	ReachablePeers []string `json:"reachablePeers,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -35,3 +98,43 @@ type PeerList struct {
 	metav1.ListMeta `json:"metadata"`
 	Items           []Peer `json:"items"`
 }
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope="Namespaced",shortName=clusterset;clustersets,categories=fleetboard
+//
+// ClusterSet holds settings shared by all the clusters, it lives in the shared namespace of hub.
+type ClusterSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ClusterSetSpec `json:"spec"`
+}
+
+type ClusterSetSpec struct {
+	// how clusters connect with each other. If empty, as without a cluster set, child clusters dial public child
+	// clusters directly and private ones reach each other through hub, the way it was before topologies.
+	// +kubebuilder:validation:Enum=hub-and-spoke;full-mesh
+	// +optional
+	Topology Topology `json:"topology,omitempty"`
+	// child clusters connecting with each other directly in hub-and-spoke as well, all the others reach them
+	// through hub.
+	// +optional
+	DirectClusters []string `json:"directClusters,omitempty"`
+}
+
+type Topology string
+
+const (
+	// TopologyHubAndSpoke means child clusters reach each other through hub, except direct clusters of the set.
+	TopologyHubAndSpoke Topology = "hub-and-spoke"
+	// TopologyFullMesh means every pair of clusters with reachable endpoints builds a direct tunnel.
+	TopologyFullMesh Topology = "full-mesh"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []ClusterSet `json:"items"`
+}
@@ -2,21 +2,29 @@ package cnf
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	mcsv1a1 "sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
+	"github.com/fleetboard-io/fleetboard/pkg/cnf/metrics"
 	syncerConfig "github.com/fleetboard-io/fleetboard/pkg/config"
 	"github.com/fleetboard-io/fleetboard/pkg/controller/syncer"
 	tunnelcontroller "github.com/fleetboard-io/fleetboard/pkg/controller/tunnels"
@@ -29,61 +37,203 @@ import (
 	"github.com/kelseyhightower/envconfig"
 )
 
+const (
+	keyRotationCheckPeriod = time.Minute
+	gatewayRoleCheckPeriod = 10 * time.Second
+
+	gatewayCandidacyCheckPeriod = 30 * time.Second
+	leaderElectionRetryPeriod   = 2 * time.Second
+	cidrReadyPollPeriod         = 5 * time.Second
+)
+
 // Manager defines configuration for cnf-related controllers
 type Manager struct {
 	agentSpec      tunnel.Specification
+	localConfig    *rest.Config
 	localK8sClient *kubernetes.Clientset
 	hubConfig      *rest.Config
 	hubClient      *fleetboardClientset.Clientset
-	wireguard      *tunnel.Wireguard
+	wireguard      tunnel.TunnelDriver
 	leaderLock     *resourcelock.LeaseLock
-	// current leader name of cnf daemon-set
-	currentLeader             string
+	// current leader name of cnf daemon-set, a string written by leader election callbacks.
+	currentLeader             atomic.Value
 	innerTunnelControllerOnce sync.Once
-	innerTunnelController     *tunnelcontroller.InnerClusterTunnelController
-	interTunnelController     *tunnelcontroller.InterClusterTunnelController
-	serviceSyncer             *syncer.Syncer
+	// candidacyCancel stops running for leader, nil if not running. Only touched by syncGatewayCandidacy.
+	candidacyCancel       context.CancelFunc
+	innerTunnelController *tunnelcontroller.InnerClusterTunnelController
+	interTunnelController *tunnelcontroller.InterClusterTunnelController
+	driftReconciler       *tunnelcontroller.DriftReconciler
+	serviceSyncer         *syncer.Syncer
+	// gateway is set once leader makes this cnf pod an additional gateway.
+	gateway atomic.Bool
+	// cidrReady is set once cidr annotations of this cnf pod are ready.
+	cidrReady atomic.Bool
+	// startup of the cnf pod is reported as events of podRef and its started condition.
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	podRef      *v1.ObjectReference
+	startup     startupState
 }
 
 func (m *Manager) Run(ctx context.Context) error {
-	// only cnf pod in master of control plane will be a candidate.
-	isCandidate := utils.CheckIfMasterOrControlNode(m.localK8sClient, m.agentSpec.NodeName)
+	defer m.broadcaster.Shutdown()
+	if len(m.agentSpec.MetricsBindAddress) != 0 {
+		go metrics.Serve(ctx, m.agentSpec.MetricsBindAddress)
+	}
+	if len(m.agentSpec.HealthProbeBindAddress) != 0 {
+		go m.serveHealth(ctx, m.agentSpec.HealthProbeBindAddress)
+	}
+	if err := m.start(ctx); err != nil {
+		m.teardown()
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	m.reportStarted(ctx)
+
+	if m.agentSpec.KeyRotationInterval > 0 {
+		go wait.UntilWithContext(ctx, m.rotateWireguardKey, keyRotationCheckPeriod)
+	}
+	go m.driftReconciler.Run(ctx)
 	if m.agentSpec.AsCluster {
-		if isCandidate {
-			go m.startLeaderElection(m.leaderLock, ctx)
-		} else {
-			go m.innerTunnelController.Start(ctx)
+		// only cnf pod on a gateway candidate node runs for leader, candidate nodes change along with cnf pods.
+		go wait.UntilWithContext(ctx, m.syncGatewayCandidacy, gatewayCandidacyCheckPeriod)
+		if m.agentSpec.MultiGateway() {
+			go wait.UntilWithContext(ctx, m.syncGatewayRole, gatewayRoleCheckPeriod)
 		}
-		m.dedinicEngine(ctx)
+		go m.dedinicEngine(ctx)
+		<-ctx.Done()
 	} else {
-		m.startLeaderElection(m.leaderLock, ctx)
+		m.startLeaderElection(m.leaderLock, ctx, ctx)
 	}
+	m.teardown()
 	return nil
 }
 
-func (m *Manager) dedinicEngine(ctx context.Context) {
-	dedinic.CNFPodName = os.Getenv(known.EnvPodName)
-	if dedinic.CNFPodName == "" {
-		klog.Fatalf("get self pod name failed")
+// teardown removes what cnf has set up when it stops: wire-guard and ip-in-ip devices along with host routes
+// through them, the bridge with dedicated nics on it and their ip allocations. Node cidr of the cnf pod is released
+// along with the pod, the peer in hub stays for the next cnf pod, cnf --cleanup --cleanup-peer removes it.
+func (m *Manager) teardown() {
+	klog.Infof("tearing down cnf pod %s", m.agentSpec.PodName)
+	if m.wireguard == nil {
+		// tunnel phase never succeeded, it cleans up after itself.
+		return
+	}
+	if err := m.wireguard.Cleanup(); err != nil {
+		klog.Errorf("failed to clean up tunnels: %v", err)
+	}
+	if m.agentSpec.AsCluster {
+		if err := dedinic.Cleanup(); err != nil {
+			klog.Errorf("failed to clean up dedicated nics: %v", err)
+		}
+	}
+}
+
+// rotateWireguardKey rotates the key of this cnf pod when it's due, and retires or rolls back a
+// rotation in progress. Inner cluster peers follow the pod annotation, gateways also republish it in peer.
+func (m *Manager) rotateWireguardKey(_ context.Context) {
+	if m.wireguard.KeyRotationDue(m.agentSpec.KeyRotationInterval, time.Now()) {
+		if err := m.wireguard.RotateKey(m.localK8sClient); err != nil {
+			klog.Errorf("failed to rotate wireguard key: %v", err)
+			return
+		}
+		m.publishPeerKey()
+		return
+	}
+
+	published, err := m.wireguard.ConfirmKeyRotation(m.localK8sClient, tunnel.KeyRotationGracePeriod)
+	if err != nil {
+		klog.Errorf("failed to confirm wireguard key rotation: %v", err)
+	}
+	if published {
+		m.publishPeerKey()
 	}
-	dedinic.CNFPodNamespace = os.Getenv(known.EnvPodNamespace)
-	if dedinic.CNFPodNamespace == "" {
-		klog.Fatalf("get self pod namespace failed")
+}
+
+// syncGatewayRole holds inter cluster tunnels while leader makes this cnf pod an additional gateway, and gives
+// them up once leader revokes the role.
+func (m *Manager) syncGatewayRole(ctx context.Context) {
+	if m.isLeader() {
+		return
+	}
+	pod, err := m.localK8sClient.CoreV1().Pods(known.FleetboardSystemNamespace).
+		Get(ctx, m.agentSpec.PodName, metav1.GetOptions{})
+	if err != nil {
+		klog.V(4).Infof("can't get cnf pod %s: %v", m.agentSpec.PodName, err)
+		return
+	}
+	gateway := pod.Labels[known.GatewayCNFLabelKey] == "true"
+	if gateway == m.gateway.Load() {
+		return
+	}
+	m.gateway.Store(gateway)
+	if gateway {
+		klog.Infof("I am a gateway: %s", m.agentSpec.PodName)
+		m.interTunnelController.StartGateway(ctx)
+	} else {
+		klog.Infof("I am no longer a gateway: %s", m.agentSpec.PodName)
+		m.interTunnelController.StopGateway()
+	}
+	// connect with every cnf pod as a gateway, or with gateways only.
+	m.innerTunnelController.EnqueueExistingAdditionalInnerConnectionHandle()
+}
+
+// publishPeerKey republishes the key of this cnf pod in our peer. Leader applies the whole peer, an additional
+// gateway updates its own entry so peers don't wait for leader to pick the key up from its pod annotation.
+func (m *Manager) publishPeerKey() {
+	var err error
+	switch {
+	case m.isLeader():
+		err = m.interTunnelController.ApplyPeerConfig()
+	case m.gateway.Load():
+		err = m.interTunnelController.PublishGatewayKey(m.wireguard.PublicKey().String(),
+			m.wireguard.NextPublicKey())
+	default:
+		return
+	}
+	if err != nil {
+		klog.Errorf("failed to publish wireguard key in hub: %v", err)
 	}
-	waitForCIDRReady(ctx, m.localK8sClient)
+}
+
+// leader is the name of the current leader cnf pod, empty if unknown.
+func (m *Manager) leader() string {
+	leader, _ := m.currentLeader.Load().(string)
+	return leader
+}
+
+func (m *Manager) isLeader() bool {
+	return m.leader() == m.agentSpec.PodName
+}
+
+func (m *Manager) dedinicEngine(ctx context.Context) {
+	if err := waitForCIDRReady(ctx, m.localK8sClient); err != nil {
+		return
+	}
+	m.cidrReady.Store(true)
 	// todo if nri is invalid
-	<-time.After(5 * time.Second)
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(5 * time.Second):
+	}
 	// add bridge
-	err := dedinic.CreateBridge(dedinic.CNFBridgeName)
-	if err != nil {
-		klog.Fatalf("create fleetboard bridge failed: %v", err)
+	if err := m.runPhase(ctx, phaseBridge, func(_ context.Context) error {
+		return dedinic.CreateBridge(dedinic.CNFBridgeName)
+	}); err != nil {
+		return
 	}
 
 	klog.Info("start cnf dedicated plugin run")
-	dedinic.InitNRIPlugin(m.localK8sClient)
+	// the plugin is started again whenever it loses the container runtime.
+	_ = m.runPhase(ctx, phaseNRIPlugin, func(ctx context.Context) error {
+		return dedinic.InitNRIPlugin(ctx, m.localK8sClient)
+	})
 }
 
-// NewCNFManager returns a new CNFController.
+// NewCNFManager returns a new CNFController, only misconfiguration fails it. What may get better by waiting is done
+// in startup phases of Run.
 func NewCNFManager(opts *tunnel.Options) (*Manager, error) {
 	localConfig, err := clientcmd.BuildConfigFromFlags("", opts.ClientConnection.Kubeconfig)
 	if err != nil {
@@ -96,17 +246,29 @@ func NewCNFManager(opts *tunnel.Options) (*Manager, error) {
 	}
 	agentSpec.Options = *opts
 	klog.Infof("got config info %v", agentSpec)
+	if errs := validation.IsDNS1123Label(agentSpec.ClusterID); len(errs) > 0 {
+		return nil, fmt.Errorf("%s is not a valid ClusterID %v", agentSpec.ClusterID, errs)
+	}
+	if agentSpec.AsCluster {
+		dedinic.CNFPodName = os.Getenv(known.EnvPodName)
+		if dedinic.CNFPodName == "" {
+			return nil, fmt.Errorf("get self pod name failed, %s is not set", known.EnvPodName)
+		}
+		dedinic.CNFPodNamespace = os.Getenv(known.EnvPodNamespace)
+		if dedinic.CNFPodNamespace == "" {
+			return nil, fmt.Errorf("get self pod namespace failed, %s is not set", known.EnvPodNamespace)
+		}
+	}
 
-	localK8sClient := kubernetes.NewForConfigOrDie(localConfig)
-
-	// create and init wire guard device
-	w, err := tunnel.CreateAndUpTunnel(localK8sClient, &agentSpec)
+	localK8sClient, err := kubernetes.NewForConfig(localConfig)
 	if err != nil {
-		klog.Fatalf("can't init wireguard tunnel: %v", err)
+		return nil, err
+	}
+	if err = mcsv1a1.AddToScheme(scheme.Scheme); err != nil {
+		return nil, fmt.Errorf("error adding multi-cluster v1alpha1 to the scheme: %v", err)
 	}
 
 	// 配置 Leader 选举
-	// TODO leader pod location with filter.
 	leaderLock := &resourcelock.LeaseLock{
 		LeaseMeta: metav1.ObjectMeta{
 			Name:      "cnf-leader-election",
@@ -118,121 +280,176 @@ func NewCNFManager(opts *tunnel.Options) (*Manager, error) {
 		},
 	}
 
-	innerTunnelController, err := tunnelcontroller.NewInnerClusterTunnelController(w, localK8sClient)
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{
+		Interface: localK8sClient.CoreV1().Events(known.FleetboardSystemNamespace),
+	})
+	metrics.RegisterMetrics()
+
+	manager := &Manager{
+		agentSpec:      agentSpec,
+		localConfig:    localConfig,
+		localK8sClient: localK8sClient,
+		leaderLock:     leaderLock,
+		broadcaster:    broadcaster,
+		recorder:       broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "cnf", Host: agentSpec.NodeName}),
+		podRef: &v1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: known.FleetboardSystemNamespace,
+			Name:      agentSpec.PodName,
+		},
+		startup: startupState{
+			pods:     localK8sClient.CoreV1().Pods(known.FleetboardSystemNamespace),
+			failures: make(map[string]error),
+		},
+	}
+	return manager, nil
+}
+
+// start runs startup phases cnf can't work without, each is retried until it succeeds.
+func (m *Manager) start(ctx context.Context) error {
+	if err := m.runPhase(ctx, phaseTunnel, m.startTunnel); err != nil {
+		return err
+	}
+	if err := m.runPhase(ctx, phaseHubConfig, m.startHubConfig); err != nil {
+		return err
+	}
+	return m.runPhase(ctx, phaseControllers, m.startControllers)
+}
+
+// startTunnel creates and inits wire guard device.
+func (m *Manager) startTunnel(_ context.Context) error {
+	w, err := tunnel.CreateAndUpTunnel(m.localK8sClient, &m.agentSpec)
 	if err != nil {
-		klog.Fatalf("get inner cluster tunnel controller failed: %v", err)
+		return fmt.Errorf("can't init wireguard tunnel: %v", err)
 	}
+	m.wireguard = w
+	metrics.RegisterTunnelCollector(w)
+	return nil
+}
 
-	var hubConfig *rest.Config
-	if agentSpec.AsCluster {
-		// wait until secret is ready.
-		hubConfig, err = syncerConfig.GetHubConfig(localK8sClient, &agentSpec)
-		if err != nil {
-			klog.Fatalf("get hub kubeconfig failed: %v", err)
+func (m *Manager) startHubConfig(_ context.Context) error {
+	hubConfig := m.localConfig
+	if m.agentSpec.AsCluster {
+		var err error
+		// secret may not be ready yet.
+		if hubConfig, err = syncerConfig.GetHubConfig(m.localK8sClient, &m.agentSpec); err != nil {
+			return fmt.Errorf("get hub kubeconfig failed: %v", err)
 		}
-	} else {
-		hubConfig = localConfig
 	}
-	hubK8sClient, err := fleetboardClientset.NewForConfig(hubConfig)
+	hubClient, err := fleetboardClientset.NewForConfig(hubConfig)
 	if err != nil {
-		klog.Fatalf("get hub fleetboard client failed: %v", err)
-		return nil, err
+		return fatal(fmt.Errorf("get hub fleetboard client failed: %v", err))
 	}
+	m.hubConfig = hubConfig
+	m.hubClient = hubClient
+	return nil
+}
 
-	hubInformerFactory := fleetinformers.NewSharedInformerFactoryWithOptions(hubK8sClient, known.DefaultResync,
-		fleetinformers.WithNamespace(agentSpec.ShareNamespace))
-	interTunnelController, err := tunnelcontroller.NewInterClusterTunnelController(&agentSpec, localK8sClient, w,
-		hubK8sClient, hubInformerFactory)
+// startControllers creates controllers, they only fail with a bad config.
+func (m *Manager) startControllers(_ context.Context) error {
+	innerTunnelController, err := tunnelcontroller.NewInnerClusterTunnelController(&m.agentSpec, m.wireguard,
+		m.localK8sClient)
 	if err != nil {
-		klog.Fatalf("start peer controller failed: %v", err)
+		return fatal(fmt.Errorf("get inner cluster tunnel controller failed: %v", err))
 	}
 
-	if errScheme := mcsv1a1.AddToScheme(scheme.Scheme); err != nil {
-		klog.Exitf("error adding multi-cluster v1alpha1 to the scheme: %v", errScheme)
-	}
-	dynamicLocalClient, dynamicError := dynamic.NewForConfig(localConfig)
-	if dynamicError != nil {
-		klog.Fatalf("error creating dynamic client: %v", err)
+	hubInformerFactory := fleetinformers.NewSharedInformerFactoryWithOptions(m.hubClient, known.DefaultResync,
+		fleetinformers.WithNamespace(m.agentSpec.ShareNamespace))
+	interTunnelController, err := tunnelcontroller.NewInterClusterTunnelController(&m.agentSpec, m.localK8sClient,
+		m.wireguard, m.hubClient, hubInformerFactory)
+	if err != nil {
+		return fatal(fmt.Errorf("start peer controller failed: %v", err))
 	}
 
-	serviceSyncer, errSyncer := syncer.New(&agentSpec, known.SyncerConfig{
-		LocalRestConfig: localConfig,
+	dynamicLocalClient, err := dynamic.NewForConfig(m.localConfig)
+	if err != nil {
+		return fatal(fmt.Errorf("error creating dynamic client: %v", err))
+	}
+	serviceSyncer, err := syncer.New(&m.agentSpec, known.SyncerConfig{
+		LocalRestConfig: m.localConfig,
 		LocalClient:     dynamicLocalClient,
-		LocalClusterID:  agentSpec.ClusterID,
-	}, hubConfig)
-	if errSyncer != nil {
-		klog.Fatalf("Failed to create syncer agent: %v", errSyncer)
-		return nil, errSyncer
+		LocalClusterID:  m.agentSpec.ClusterID,
+	}, m.hubConfig)
+	if err != nil {
+		return fatal(fmt.Errorf("failed to create syncer agent: %v", err))
 	}
 
-	manager := &Manager{
-		agentSpec:             agentSpec,
-		wireguard:             w,
-		localK8sClient:        localK8sClient,
-		hubConfig:             hubConfig,
-		hubClient:             hubK8sClient,
-		leaderLock:            leaderLock,
-		currentLeader:         "",
-		innerTunnelController: innerTunnelController,
-		interTunnelController: interTunnelController,
-		serviceSyncer:         serviceSyncer,
-	}
-	return manager, nil
+	m.innerTunnelController = innerTunnelController
+	m.interTunnelController = interTunnelController
+	m.driftReconciler = tunnelcontroller.NewDriftReconciler(m.wireguard, m.recorder, m.podRef)
+	m.serviceSyncer = serviceSyncer
+	return nil
 }
 
-func (m *Manager) startLeaderElection(lock resourcelock.Interface, ctx context.Context) {
-	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+// startLeaderElection runs for leader until electionCtx is done, it runs again after losing the lease, e.g. when
+// hub or api server blips. Controllers shared with followers live on until runCtx is done.
+func (m *Manager) startLeaderElection(lock resourcelock.Interface, runCtx, electionCtx context.Context) {
+	wait.UntilWithContext(electionCtx, func(electionCtx context.Context) {
+		m.runLeaderElection(lock, runCtx, electionCtx)
+	}, leaderElectionRetryPeriod)
+}
+
+func (m *Manager) runLeaderElection(lock resourcelock.Interface, runCtx, electionCtx context.Context) {
+	leaderelection.RunOrDie(electionCtx, leaderelection.LeaderElectionConfig{
 		Lock:          lock,
 		LeaseDuration: 15 * time.Second,
 		RenewDeadline: 10 * time.Second,
-		RetryPeriod:   2 * time.Second,
+		RetryPeriod:   leaderElectionRetryPeriod,
 		Callbacks: leaderelection.LeaderCallbacks{
 			OnStartedLeading: func(ctx context.Context) {
-				klog.Infof("I am the leader: %s", m.wireguard.Spec.PodName)
+				klog.Infof("I am the leader: %s", m.agentSpec.PodName)
+				metrics.Leader.Set(1)
 
-				m.innerTunnelController.RecycleAllResources()
-				m.currentLeader = m.wireguard.Spec.PodName
-				m.innerTunnelController.SetCurrentLeader(m.currentLeader)
+				m.currentLeader.Store(m.agentSpec.PodName)
+				m.innerTunnelController.ReconcileLeader(m.agentSpec.PodName)
 
-				m.interTunnelController.Start(ctx)
+				m.interTunnelController.Start(runCtx, ctx)
 				if m.agentSpec.AsCluster {
 					go func() {
-						if syncerStartErr := m.serviceSyncer.Start(ctx); syncerStartErr != nil {
-							klog.Fatalf("Failed to start syncer agent: %v", syncerStartErr)
-						}
+						_ = m.runPhase(ctx, phaseSyncer, m.serviceSyncer.Start)
 					}()
-					if errConfig := m.innerTunnelController.ConfigWithExistingCIDR(m.hubClient); errConfig != nil {
-						klog.Fatalf("failed to config annotation: %v", errConfig)
+					if errConfig := m.runPhase(ctx, phaseCIDR, func(_ context.Context) error {
+						return m.innerTunnelController.ConfigWithExistingCIDR(m.hubClient)
+					}); errConfig != nil {
+						return
 					}
 					m.innerTunnelController.EnqueueExistingAdditionalInnerConnectionHandle()
 					m.innerTunnelControllerOnce.Do(func() {
-						go m.innerTunnelController.Start(ctx)
+						go m.innerTunnelController.Start(runCtx)
 					})
 				}
 			},
 			OnStoppedLeading: func() {
-				klog.Infof("I am no longer the leader: %s", m.wireguard.Spec.PodName)
-				m.currentLeader = ""
+				klog.Infof("I am no longer the leader: %s", m.agentSpec.PodName)
+				m.currentLeader.Store("")
+				metrics.Leader.Set(0)
+				m.interTunnelController.StopLeading()
+				// so other cnf pods don't take a stale label for the new leader.
+				utils.UpdatePodLabels(m.localK8sClient, m.agentSpec.PodName, false)
 			},
 			OnNewLeader: func(identity string) {
-				if identity == m.wireguard.Spec.PodName {
+				metrics.LeaderTransitions.Inc()
+				if identity == m.agentSpec.PodName {
 					// already handled, so ignore.
 					return
 				}
 
 				klog.Infof("New leader elected: %s", identity)
 
-				m.interTunnelController.RecycleAllResources()
-				m.innerTunnelController.RecycleAllResources()
+				// only gateways hold inter cluster tunnels, with multiple gateways they survive leader changes.
+				if !m.agentSpec.MultiGateway() {
+					m.interTunnelController.RecycleAllResources()
+				}
 
-				m.currentLeader = identity
-				m.innerTunnelController.SetCurrentLeader(m.currentLeader)
-				utils.UpdatePodLabels(m.localK8sClient, m.wireguard.Spec.PodName, false)
+				m.currentLeader.Store(identity)
+				m.innerTunnelController.ReconcileLeader(identity)
+				utils.UpdatePodLabels(m.localK8sClient, m.agentSpec.PodName, false)
 
 				if m.agentSpec.AsCluster {
 					m.innerTunnelController.EnqueueAdditionalInnerConnectionHandleObj(identity)
 					m.innerTunnelControllerOnce.Do(func() {
-						go m.innerTunnelController.Start(ctx)
+						go m.innerTunnelController.Start(runCtx)
 					})
 				}
 			},
@@ -242,8 +459,9 @@ func (m *Manager) startLeaderElection(lock resourcelock.Interface, ctx context.C
 	})
 }
 
-func waitForCIDRReady(ctx context.Context, k8sClient *kubernetes.Clientset) {
-	for dedinic.NodeCIDR == "" || dedinic.TunnelCIDR == "" || dedinic.CNFPodIP == "" || dedinic.ServiceCIDR == "" {
+// waitForCIDRReady waits for cidr annotations of this cnf pod until ctx is done.
+func waitForCIDRReady(ctx context.Context, k8sClient *kubernetes.Clientset) error {
+	err := wait.PollUntilContextCancel(ctx, cidrReadyPollPeriod, true, func(ctx context.Context) (bool, error) {
 		pod, err := k8sClient.CoreV1().Pods(dedinic.CNFPodNamespace).Get(ctx, dedinic.CNFPodName, metav1.GetOptions{})
 		if err == nil && pod != nil {
 			klog.Infof("wait for cnf cidr ready: cnf annotions: %v", pod.Annotations)
@@ -254,8 +472,13 @@ func waitForCIDRReady(ctx context.Context, k8sClient *kubernetes.Clientset) {
 		} else {
 			klog.Errorf("wait for cnf cidr ready: not finding the cnf pod")
 		}
-		<-time.After(5 * time.Second)
+		return dedinic.NodeCIDR != "" && dedinic.TunnelCIDR != "" && dedinic.CNFPodIP != "" &&
+			dedinic.ServiceCIDR != "", nil
+	})
+	if err != nil {
+		return err
 	}
 	klog.Infof("cnf cidr ready, nodecidr: %v, globalcidr: %v, cnfpodip: %v, innerclusteripcidr: %v",
 		dedinic.NodeCIDR, dedinic.TunnelCIDR, dedinic.CNFPodIP, dedinic.ServiceCIDR)
+	return nil
 }
@@ -0,0 +1,110 @@
+package cnf
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/utils"
+	"github.com/pkg/errors"
+)
+
+// isGatewayCandidate tells if cnf pod on this node runs for leader. Candidates are nodes picked by
+// names or label selector, master and control plane nodes by default. When no cnf pod runs on a candidate,
+// which is the case for managed kubernetes, any node may run if fallback is enabled.
+func (m *Manager) isGatewayCandidate(ctx context.Context) (bool, error) {
+	selector, err := labels.Parse(m.agentSpec.GatewayNodeSelector)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid gateway node selector %q", m.agentSpec.GatewayNodeSelector)
+	}
+	names := sets.New[string](m.agentSpec.GatewayNodes...)
+
+	nodes, err := m.localK8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, errors.Wrap(err, "can't list nodes for gateway candidates")
+	}
+	candidates := sets.New[string]()
+	for i := range nodes.Items {
+		if matchesGatewayCandidate(&nodes.Items[i], selector, names) {
+			candidates.Insert(nodes.Items[i].Name)
+		}
+	}
+	if candidates.Has(m.agentSpec.NodeName) {
+		return true, nil
+	}
+	if !m.agentSpec.GatewayCandidateFallback {
+		return false, nil
+	}
+
+	pods, err := m.localK8sClient.CoreV1().Pods(known.FleetboardSystemNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: known.LabelCNFPod,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "can't list cnf pods for gateway candidates")
+	}
+	for _, pod := range pods.Items {
+		if candidates.Has(pod.Spec.NodeName) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// syncGatewayCandidacy runs for leader while this node is a gateway candidate, and gives up once cnf pods on
+// candidate nodes appear. Cnf pods not running for leader follow whoever leads.
+func (m *Manager) syncGatewayCandidacy(ctx context.Context) {
+	isCandidate, err := m.isGatewayCandidate(ctx)
+	if err != nil {
+		klog.Errorf("can't tell if node %s is a gateway candidate: %v", m.agentSpec.NodeName, err)
+		return
+	}
+	if !isCandidate {
+		m.innerTunnelControllerOnce.Do(func() {
+			go m.innerTunnelController.Start(ctx)
+		})
+	}
+	running := m.candidacyCancel != nil
+	if isCandidate == running {
+		return
+	}
+	if !isCandidate {
+		klog.Infof("node %s is not a gateway candidate any more, stop running for leader", m.agentSpec.NodeName)
+		m.candidacyCancel()
+		m.candidacyCancel = nil
+		if m.agentSpec.MultiGateway() {
+			if err = utils.UpdatePodLabel(m.localK8sClient, m.agentSpec.PodName, known.GatewayCandidateLabelKey,
+				false); err != nil {
+				klog.Errorf("can't unmark myself as a gateway candidate: %v", err)
+			}
+		}
+		return
+	}
+
+	klog.Infof("node %s is a gateway candidate, run for leader", m.agentSpec.NodeName)
+	candidacyCtx, cancel := context.WithCancel(ctx)
+	m.candidacyCancel = cancel
+	if m.agentSpec.MultiGateway() {
+		if err = utils.UpdatePodLabel(m.localK8sClient, m.agentSpec.PodName, known.GatewayCandidateLabelKey,
+			true); err != nil {
+			klog.Errorf("can't mark myself as a gateway candidate: %v", err)
+		}
+	}
+	go m.startLeaderElection(m.leaderLock, ctx, candidacyCtx)
+}
+
+func matchesGatewayCandidate(node *v1.Node, selector labels.Selector, names sets.Set[string]) bool {
+	if names.Len() != 0 {
+		return names.Has(node.Name)
+	}
+	if !selector.Empty() {
+		return selector.Matches(labels.Set(node.Labels))
+	}
+	_, isMaster := node.Labels["node-role.kubernetes.io/master"]
+	_, isControlPlane := node.Labels["node-role.kubernetes.io/control-plane"]
+	return isMaster || isControlPlane
+}
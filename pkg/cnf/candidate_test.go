@@ -0,0 +1,72 @@
+package cnf
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func Test_matchesGatewayCandidate(t *testing.T) {
+	newNode := func(name string, nodeLabels map[string]string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels}}
+	}
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		selector string
+		names    []string
+		want     bool
+	}{
+		{
+			name: "master by default",
+			node: newNode("master", map[string]string{"node-role.kubernetes.io/master": ""}),
+			want: true,
+		},
+		{
+			name: "control plane by default",
+			node: newNode("cp", map[string]string{"node-role.kubernetes.io/control-plane": ""}),
+			want: true,
+		},
+		{
+			name: "worker is not by default",
+			node: newNode("worker", map[string]string{"node-role.kubernetes.io/worker": ""}),
+		},
+		{
+			name:     "matching selector",
+			node:     newNode("edge", map[string]string{"fleetboard.io/gateway": "true"}),
+			selector: "fleetboard.io/gateway=true",
+			want:     true,
+		},
+		{
+			name:     "selector replaces control plane",
+			node:     newNode("cp", map[string]string{"node-role.kubernetes.io/control-plane": ""}),
+			selector: "fleetboard.io/gateway=true",
+		},
+		{
+			name:     "names win over selector",
+			node:     newNode("edge", map[string]string{"fleetboard.io/gateway": "true"}),
+			selector: "fleetboard.io/gateway=true",
+			names:    []string{"other"},
+		},
+		{
+			name:  "picked by name",
+			node:  newNode("edge", nil),
+			names: []string{"edge"},
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchesGatewayCandidate(tt.node, selector, sets.New(tt.names...)); got != tt.want {
+				t.Errorf("matchesGatewayCandidate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
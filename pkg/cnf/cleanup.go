@@ -0,0 +1,69 @@
+package cnf
+
+import (
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	syncerConfig "github.com/fleetboard-io/fleetboard/pkg/config"
+	"github.com/fleetboard-io/fleetboard/pkg/dedinic"
+	fleetboardClientset "github.com/fleetboard-io/fleetboard/pkg/generated/clientset/versioned"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+	"github.com/fleetboard-io/fleetboard/utils"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Cleanup removes what cnf leaves in the network namespace it runs in, and the peer of this cluster in hub
+// with --cleanup-peer.
+func Cleanup(opts *tunnel.Options) error {
+	var errs []error
+	if err := tunnel.CleanupLeftovers(); err != nil {
+		errs = append(errs, err)
+	}
+	if opts.AsCluster {
+		if err := dedinic.Cleanup(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if opts.CleanupPeer {
+		if err := deletePeer(opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// deletePeer deletes the peer of this cluster in hub, hub releases its cidr and other clusters drop their tunnels.
+func deletePeer(opts *tunnel.Options) error {
+	localConfig, err := clientcmd.BuildConfigFromFlags("", opts.ClientConnection.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	var agentSpec tunnel.Specification
+	if err = envconfig.Process(known.FleetboardConfigPrefix, &agentSpec); err != nil {
+		return err
+	}
+	agentSpec.Options = *opts
+
+	hubConfig := localConfig
+	if agentSpec.AsCluster {
+		var localK8sClient kubernetes.Interface
+		if localK8sClient, err = kubernetes.NewForConfig(localConfig); err != nil {
+			return err
+		}
+		if hubConfig, err = syncerConfig.GetHubConfig(localK8sClient, &agentSpec); err != nil {
+			return err
+		}
+	}
+	hubClient, err := fleetboardClientset.NewForConfig(hubConfig)
+	if err != nil {
+		return err
+	}
+	if err = utils.DeletePeerWithRetry(hubClient, agentSpec.ClusterID, agentSpec.ShareNamespace); err != nil {
+		return err
+	}
+	klog.Infof("peer %s is deleted from hub", agentSpec.ClusterID)
+	return nil
+}
@@ -0,0 +1,109 @@
+package cnf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/dedinic"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+const hubCheckTimeout = 5 * time.Second
+
+// serveHealth serves /healthz and /readyz on address until ctx is done, every subsystem is a check of its own,
+// e.g. /readyz/hub. Failing healthz gets a stuck cnf pod restarted, readyz holds rollouts until it works.
+func (m *Manager) serveHealth(ctx context.Context, address string) {
+	mux := http.NewServeMux()
+	healthz.InstallHandler(mux, m.livenessChecks()...)
+	healthz.InstallReadyzHandler(mux, m.readinessChecks()...)
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	klog.Infof("serving health probes on %s", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.Errorf("health probe server stopped: %v", err)
+	}
+}
+
+// livenessChecks fail only when waiting can't help. The nri plugin is started again with backoff, so it's only
+// checked for readiness.
+func (m *Manager) livenessChecks() []healthz.HealthChecker {
+	return []healthz.HealthChecker{
+		healthz.NamedCheck("wireguard", func(_ *http.Request) error {
+			if !m.started() {
+				// tunnel phase is retried, restarting doesn't help.
+				return nil
+			}
+			return tunnel.DeviceUp()
+		}),
+	}
+}
+
+func (m *Manager) readinessChecks() []healthz.HealthChecker {
+	checks := append(m.livenessChecks(),
+		healthz.NamedCheck("started", func(_ *http.Request) error {
+			if !m.started() {
+				return fmt.Errorf("waiting for startup phases")
+			}
+			return nil
+		}),
+		healthz.NamedCheck("hub", m.checkHub))
+	if !m.agentSpec.AsCluster {
+		return checks
+	}
+	return append(checks,
+		healthz.NamedCheck("cidr", func(_ *http.Request) error {
+			if !m.cidrReady.Load() {
+				return fmt.Errorf("waiting for cidr annotations")
+			}
+			return nil
+		}),
+		healthz.NamedCheck("nri-connected", func(_ *http.Request) error {
+			if !dedinic.NRIConnected() {
+				return fmt.Errorf("nri plugin is not connected to the container runtime")
+			}
+			return nil
+		}),
+		healthz.NamedCheck("hub-peer", m.checkHubPeer),
+	)
+}
+
+// checkHub tells if api server of hub is reachable.
+func (m *Manager) checkHub(r *http.Request) error {
+	if !m.started() {
+		// no hub client yet, started check fails meanwhile.
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), hubCheckTimeout)
+	defer cancel()
+	return m.hubClient.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+}
+
+// checkHubPeer tells if leader has a tunnel with hub, other cnf pods go through leader.
+func (m *Manager) checkHubPeer(_ *http.Request) error {
+	if !m.started() || !m.isLeader() {
+		return nil
+	}
+	devicePeers, err := m.wireguard.DevicePeers()
+	if err != nil {
+		return err
+	}
+	for _, peer := range m.wireguard.GetAllExistingInterConnection() {
+		if _, found := devicePeers[peer.Spec.PublicKey]; found && peer.Spec.IsHub {
+			return nil
+		}
+	}
+	return fmt.Errorf("leader has no hub peer configured")
+}
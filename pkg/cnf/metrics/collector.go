@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+// tunnel types
+const (
+	tunnelInner = "inner"
+	tunnelInter = "inter"
+)
+
+var (
+	tunnelsDesc = metrics.NewDesc(metrics.BuildFQName("", CNFSubsystem, "tunnels"),
+		"Number of tunnels by type, inner tunnels connect cnf pods, inter tunnels connect clusters",
+		[]string{"type"}, nil, metrics.ALPHA, "")
+	handshakeAgeDesc = metrics.NewDesc(metrics.BuildFQName("", CNFSubsystem, "peer_last_handshake_age_seconds"),
+		"Seconds since the last handshake with a peer",
+		[]string{"type", "peer", "public_key"}, nil, metrics.ALPHA, "")
+	receiveBytesDesc = metrics.NewDesc(metrics.BuildFQName("", CNFSubsystem, "peer_receive_bytes_total"),
+		"Bytes received from a peer",
+		[]string{"type", "peer", "public_key"}, nil, metrics.ALPHA, "")
+	transmitBytesDesc = metrics.NewDesc(metrics.BuildFQName("", CNFSubsystem, "peer_transmit_bytes_total"),
+		"Bytes transmitted to a peer",
+		[]string{"type", "peer", "public_key"}, nil, metrics.ALPHA, "")
+)
+
+// tunnelCollector reads tunnels and peer stats from the device at scrape time.
+type tunnelCollector struct {
+	metrics.BaseStableCollector
+	tunnel tunnel.TunnelDriver
+}
+
+// RegisterTunnelCollector registers metrics of tunnels on t.
+func RegisterTunnelCollector(t tunnel.TunnelDriver) {
+	legacyregistry.CustomMustRegister(&tunnelCollector{tunnel: t})
+}
+
+func (c *tunnelCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- tunnelsDesc
+	ch <- handshakeAgeDesc
+	ch <- receiveBytesDesc
+	ch <- transmitBytesDesc
+}
+
+func (c *tunnelCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	type owner struct{ tunnelType, name string }
+	owners := make(map[string]owner)
+	inter := c.tunnel.GetAllExistingInterConnection()
+	for id, peer := range inter {
+		for _, key := range tunnel.PeerKeys(peer) {
+			owners[key] = owner{tunnelType: tunnelInter, name: id}
+		}
+	}
+	inner := c.tunnel.GetAllExistingInnerConnection()
+	for nodeID, config := range inner {
+		for _, key := range config.Keys() {
+			owners[key] = owner{tunnelType: tunnelInner, name: nodeID}
+		}
+	}
+	ch <- metrics.NewLazyConstMetric(tunnelsDesc, metrics.GaugeValue, float64(len(inner)), tunnelInner)
+	ch <- metrics.NewLazyConstMetric(tunnelsDesc, metrics.GaugeValue, float64(len(inter)), tunnelInter)
+
+	devicePeers, err := c.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't collect peer metrics: %v", err)
+		return
+	}
+	now := time.Now()
+	for key, devicePeer := range devicePeers {
+		o, found := owners[key]
+		if !found {
+			continue
+		}
+		collectPeer(ch, o.tunnelType, o.name, key, devicePeer, now)
+	}
+}
+
+func collectPeer(ch chan<- metrics.Metric, tunnelType, name, key string, peer wgtypes.Peer, now time.Time) {
+	if !peer.LastHandshakeTime.IsZero() {
+		ch <- metrics.NewLazyConstMetric(handshakeAgeDesc, metrics.GaugeValue,
+			now.Sub(peer.LastHandshakeTime).Seconds(), tunnelType, name, key)
+	}
+	ch <- metrics.NewLazyConstMetric(receiveBytesDesc, metrics.CounterValue, float64(peer.ReceiveBytes),
+		tunnelType, name, key)
+	ch <- metrics.NewLazyConstMetric(transmitBytesDesc, metrics.CounterValue, float64(peer.TransmitBytes),
+		tunnelType, name, key)
+}
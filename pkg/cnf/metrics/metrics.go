@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"sync"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// CNFSubsystem - subsystem name used by cnf.
+const CNFSubsystem = "cnf"
+
+var (
+	// TunnelDrifts tracks divergences of the wire-guard device and its routes from tunnels cnf holds,
+	// each one is repaired.
+	TunnelDrifts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "tunnel_drifts_total",
+			Help:           "Number of divergences of the wire-guard device and its routes repaired",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"kind"},
+	)
+	// Leader tells if this cnf pod is the leader.
+	Leader = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "leader",
+			Help:           "1 if this cnf pod is the leader, 0 otherwise",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	// LeaderTransitions tracks leader changes this cnf pod has seen.
+	LeaderTransitions = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "leader_transitions_total",
+			Help:           "Number of leader changes seen",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	// NodeCIDRsAllocated tracks node cidrs leader has allocated to cnf pods from the cluster cidr.
+	NodeCIDRsAllocated = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "node_cidrs_allocated",
+			Help:           "Number of node cidrs allocated from the cluster cidr",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	// NodeCIDRsAvailable tracks node cidrs left in the cluster cidr.
+	NodeCIDRsAvailable = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "node_cidrs_available",
+			Help:           "Number of node cidrs left in the cluster cidr",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+	// NRIOperationDuration tracks how long adding or deleting dedicated nics of pods takes.
+	NRIOperationDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "nri_operation_duration_seconds",
+			Help:           "Latency of adding or deleting dedicated nics of pods in seconds",
+			StabilityLevel: metrics.ALPHA,
+			Buckets:        metrics.ExponentialBuckets(0.005, 2, 12),
+		},
+		[]string{"operation"}, // either "add" or "delete"
+	)
+	// NRIOperationFailures tracks failures of adding or deleting dedicated nics of pods.
+	NRIOperationFailures = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "nri_operation_failures_total",
+			Help:           "Number of failures adding or deleting dedicated nics of pods",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+	// SyncerReconcileErrors tracks failed reconciles of service export and import controllers.
+	SyncerReconcileErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Subsystem:      CNFSubsystem,
+			Name:           "syncer_reconcile_errors_total",
+			Help:           "Number of failed reconciles of the syncer",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"controller"}, // either "serviceexport" or "serviceimport"
+	)
+)
+
+var registerMetrics sync.Once
+
+// RegisterMetrics registers cnf metrics.
+func RegisterMetrics() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(TunnelDrifts)
+		legacyregistry.MustRegister(Leader)
+		legacyregistry.MustRegister(LeaderTransitions)
+		legacyregistry.MustRegister(NodeCIDRsAllocated)
+		legacyregistry.MustRegister(NodeCIDRsAvailable)
+		legacyregistry.MustRegister(NRIOperationDuration)
+		legacyregistry.MustRegister(NRIOperationFailures)
+		legacyregistry.MustRegister(SyncerReconcileErrors)
+	})
+}
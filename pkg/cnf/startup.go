@@ -0,0 +1,179 @@
+package cnf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+// startup phases, a failing phase is retried with backoff and reported on the cnf pod with the phase as reason.
+const (
+	phaseTunnel      = "Tunnel"
+	phaseHubConfig   = "HubConfig"
+	phaseControllers = "Controllers"
+	phaseBridge      = "Bridge"
+	phaseNRIPlugin   = "NRIPlugin"
+	phaseSyncer      = "Syncer"
+	phaseCIDR        = "CIDR"
+)
+
+const (
+	reasonStarted       = "Started"
+	reasonStartupFailed = "StartupFailed"
+)
+
+var startupBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      time.Minute,
+}
+
+// fatalError is a misconfiguration retrying can't fix, cnf exits with it.
+type fatalError struct {
+	error
+}
+
+func (e *fatalError) Unwrap() error {
+	return e.error
+}
+
+func fatal(err error) error {
+	return &fatalError{error: err}
+}
+
+func isFatal(err error) bool {
+	var f *fatalError
+	return errors.As(err, &f)
+}
+
+// startupState is what is reported in the started condition of the cnf pod.
+type startupState struct {
+	sync.Mutex
+	// pods is where the cnf pod is.
+	pods    v1core.PodInterface
+	started bool
+	// failing phases with their last error.
+	failures   map[string]error
+	status     v1.ConditionStatus
+	transition metav1.Time
+}
+
+// runPhase runs the phase until it succeeds, fails fatally or ctx is done. Every failure is reported as an event
+// and the started condition of the cnf pod, it's cleared once the phase succeeds.
+func (m *Manager) runPhase(ctx context.Context, phase string, run func(ctx context.Context) error) error {
+	backoff := startupBackoff
+	for {
+		err := run(ctx)
+		m.reportPhase(ctx, phase, err)
+		if err == nil {
+			return nil
+		}
+		if isFatal(err) {
+			klog.Errorf("startup phase %s failed: %v", phase, err)
+			return err
+		}
+		klog.Errorf("startup phase %s failed, retrying: %v", phase, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// reportStarted marks the cnf pod started once all phases it can't work without are done.
+func (m *Manager) reportStarted(ctx context.Context) {
+	m.startup.Lock()
+	m.startup.started = true
+	m.startup.Unlock()
+	m.recorder.Event(m.podRef, v1.EventTypeNormal, reasonStarted, "cnf has started")
+	m.syncStartedCondition(ctx)
+}
+
+// started tells if the cnf pod has started, fields set in startup phases are safe to use then.
+func (m *Manager) started() bool {
+	m.startup.Lock()
+	defer m.startup.Unlock()
+	return m.startup.started
+}
+
+func (m *Manager) reportPhase(ctx context.Context, phase string, err error) {
+	m.startup.Lock()
+	_, failing := m.startup.failures[phase]
+	if err == nil {
+		delete(m.startup.failures, phase)
+	} else {
+		m.startup.failures[phase] = err
+	}
+	m.startup.Unlock()
+	if err != nil {
+		m.recorder.Eventf(m.podRef, v1.EventTypeWarning, reasonStartupFailed, "phase %s failed: %v", phase, err)
+	}
+	if err != nil || failing {
+		m.syncStartedCondition(ctx)
+	}
+}
+
+// syncStartedCondition writes the started condition of the cnf pod, it's false with the first failing phase as
+// reason, or true once started without failures.
+func (m *Manager) syncStartedCondition(ctx context.Context) {
+	m.startup.Lock()
+	defer m.startup.Unlock()
+	condition := v1.PodCondition{
+		Type:   known.CNFStartedCondition,
+		Status: v1.ConditionTrue,
+		Reason: reasonStarted,
+	}
+	if len(m.startup.failures) != 0 {
+		phases := make([]string, 0, len(m.startup.failures))
+		for phase := range m.startup.failures {
+			phases = append(phases, phase)
+		}
+		sort.Strings(phases)
+		condition.Status = v1.ConditionFalse
+		condition.Reason = phases[0]
+		condition.Message = m.startup.failures[phases[0]].Error()
+	} else if !m.startup.started {
+		return
+	}
+	condition.LastTransitionTime = m.startup.transition
+	if condition.Status != m.startup.status {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	if err := m.patchPodCondition(ctx, condition); err != nil {
+		klog.Errorf("failed to report %s condition: %v", known.CNFStartedCondition, err)
+		return
+	}
+	m.startup.status = condition.Status
+	m.startup.transition = condition.LastTransitionTime
+}
+
+func (m *Manager) patchPodCondition(ctx context.Context, condition v1.PodCondition) error {
+	// conditions are merged by type, other conditions of the pod are left alone.
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.PodCondition{condition},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.startup.pods.Patch(ctx, m.podRef.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{},
+		"status")
+	return err
+}
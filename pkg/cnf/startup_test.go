@@ -0,0 +1,91 @@
+package cnf
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+func TestRunPhase(t *testing.T) {
+	backoff := startupBackoff
+	t.Cleanup(func() { startupBackoff = backoff })
+	startupBackoff.Duration = time.Millisecond
+	tests := []struct {
+		name       string
+		errs       []error
+		wantErr    bool
+		wantRuns   int
+		wantStatus v1.ConditionStatus
+		wantReason string
+	}{
+		{
+			name:       "succeeds at once",
+			wantRuns:   1,
+			wantStatus: v1.ConditionTrue,
+			wantReason: reasonStarted,
+		},
+		{
+			name:       "retried until it succeeds",
+			errs:       []error{fmt.Errorf("secret not found"), fmt.Errorf("secret not found")},
+			wantRuns:   3,
+			wantStatus: v1.ConditionTrue,
+			wantReason: reasonStarted,
+		},
+		{
+			name:       "fatal is not retried",
+			errs:       []error{fatal(fmt.Errorf("bad kubeconfig"))},
+			wantErr:    true,
+			wantRuns:   1,
+			wantStatus: v1.ConditionFalse,
+			wantReason: phaseHubConfig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cnf-0", Namespace: known.FleetboardSystemNamespace}}
+			client := fake.NewSimpleClientset(pod)
+			m := &Manager{
+				recorder: record.NewFakeRecorder(10),
+				podRef:   &v1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name},
+				startup: startupState{
+					pods:     client.CoreV1().Pods(pod.Namespace),
+					failures: make(map[string]error),
+				},
+			}
+			runs := 0
+			err := m.runPhase(context.Background(), phaseHubConfig, func(_ context.Context) error {
+				runs++
+				if runs <= len(tt.errs) {
+					return tt.errs[runs-1]
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr || runs != tt.wantRuns {
+				t.Fatalf("runPhase() = %v after %d runs, want error %v after %d runs", err, runs, tt.wantErr,
+					tt.wantRuns)
+			}
+			if err == nil {
+				m.reportStarted(context.Background())
+			}
+			got, _ := client.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+			for _, condition := range got.Status.Conditions {
+				if condition.Type == known.CNFStartedCondition {
+					if condition.Status != tt.wantStatus || condition.Reason != tt.wantReason {
+						t.Errorf("condition = %s %s, want %s %s", condition.Status, condition.Reason,
+							tt.wantStatus, tt.wantReason)
+					}
+					return
+				}
+			}
+			t.Errorf("no %s condition", known.CNFStartedCondition)
+		})
+	}
+}
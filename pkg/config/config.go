@@ -175,13 +175,14 @@ func getGlobalAndClusterCIDRByHubClient(ctx context.Context, fleetboardClient *f
 		return "", "", listErr
 	}
 	for _, peer := range peerList.Items {
-		switch peer.Name {
-		case known.HubClusterName:
+		if len(peer.Spec.PodCIDR) == 0 {
+			continue
+		}
+		// every hub advertises the same global cidr.
+		if peer.Spec.IsHub {
 			globalCIDR = peer.Spec.PodCIDR[0]
-		case localClusterID:
-			if len(peer.Spec.PodCIDR) != 0 {
-				clusterCIDR = peer.Spec.PodCIDR[0]
-			}
+		} else if peer.Name == localClusterID {
+			clusterCIDR = peer.Spec.PodCIDR[0]
 		}
 	}
 	return globalCIDR, clusterCIDR, nil
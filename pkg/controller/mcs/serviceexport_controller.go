@@ -26,6 +26,7 @@ import (
 	alpha1 "sigs.k8s.io/mcs-api/pkg/client/listers/apis/v1alpha1"
 
 	"github.com/dixudx/yacht"
+	"github.com/fleetboard-io/fleetboard/pkg/cnf/metrics"
 	"github.com/fleetboard-io/fleetboard/pkg/known"
 	"github.com/fleetboard-io/fleetboard/utils"
 )
@@ -73,7 +74,11 @@ func NewServiceExportController(clusteID string,
 			case <-ctx.Done():
 				return nil, nil
 			default:
-				return sec.Handle(key)
+				requeueAfter, err := sec.Handle(key)
+				if err != nil {
+					metrics.SyncerReconcileErrors.WithLabelValues("serviceexport").Inc()
+				}
+				return requeueAfter, err
 			}
 		})
 	_, err := seInformer.Informer().AddEventHandler(yachtcontroller.DefaultResourceEventHandlerFuncs())
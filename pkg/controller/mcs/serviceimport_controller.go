@@ -25,6 +25,7 @@ import (
 	alpha1 "sigs.k8s.io/mcs-api/pkg/client/listers/apis/v1alpha1"
 
 	"github.com/dixudx/yacht"
+	"github.com/fleetboard-io/fleetboard/pkg/cnf/metrics"
 	"github.com/fleetboard-io/fleetboard/pkg/known"
 	"github.com/fleetboard-io/fleetboard/utils"
 )
@@ -69,7 +70,11 @@ func NewServiceImportController(kubeclient kubernetes.Interface,
 			case <-ctx.Done():
 				return nil, nil
 			default:
-				return sic.Handle(key)
+				requeueAfter, err := sic.Handle(key)
+				if err != nil {
+					metrics.SyncerReconcileErrors.WithLabelValues("serviceimport").Inc()
+				}
+				return requeueAfter, err
 			}
 		})
 	_, err := sic.localSIInformer.Informer().AddEventHandler(yachtcontroller.DefaultResourceEventHandlerFuncs())
@@ -0,0 +1,54 @@
+package tunnels
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/cnf/metrics"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+const driftCheckPeriod = 30 * time.Second
+
+// DriftReconciler repairs the wire-guard device and routes through it when they are changed behind our back,
+// only peer and pod events drive tunnel controllers. Every repair shows up as an event of the cnf pod.
+type DriftReconciler struct {
+	tunnel   tunnel.TunnelDriver
+	recorder record.EventRecorder
+	pod      *v1.ObjectReference
+}
+
+// NewDriftReconciler reports repairs with recorder as events of pod.
+func NewDriftReconciler(tunnel tunnel.TunnelDriver, recorder record.EventRecorder,
+	pod *v1.ObjectReference) *DriftReconciler {
+	metrics.RegisterMetrics()
+	return &DriftReconciler{
+		tunnel:   tunnel,
+		recorder: recorder,
+		pod:      pod,
+	}
+}
+
+func (d *DriftReconciler) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, d.reconcile, driftCheckPeriod)
+}
+
+func (d *DriftReconciler) reconcile(_ context.Context) {
+	drifts, err := d.tunnel.Reconcile()
+	for _, drift := range drifts {
+		klog.Warningf("repaired drift of %s: %s", known.DefaultDeviceName, drift)
+		metrics.TunnelDrifts.WithLabelValues(drift.Kind).Inc()
+		d.recorder.Eventf(d.pod, v1.EventTypeWarning, "TunnelDrift", "repaired %s", drift)
+	}
+	if err != nil {
+		klog.Errorf("failed to reconcile %s: %v", known.DefaultDeviceName, err)
+		d.recorder.Eventf(d.pod, v1.EventTypeWarning, "TunnelDriftFailed", "failed to reconcile %s: %v",
+			known.DefaultDeviceName, err)
+	}
+}
@@ -0,0 +1,135 @@
+package tunnels
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+	"github.com/fleetboard-io/fleetboard/utils"
+)
+
+const gatewayRouteSyncPeriod = 10 * time.Second
+
+// shouldHandleGatewayPod decides tunnels with multiple gateways: gateways connect with every cnf pod, the others
+// connect with gateways only.
+func (ict *InnerClusterTunnelController) shouldHandleGatewayPod(pod *v1.Pod) bool {
+	if pod.Labels[known.LeaderCNFLabelKey] == "true" && ict.GetCurrentLeader() != pod.Name {
+		// gateways stay, no need to recycle tunnels when leader changes.
+		ict.SetCurrentLeader(pod.Name)
+	}
+	if ict.spec.PodName == ict.GetCurrentLeader() {
+		return true
+	}
+	if pod.Name == ict.spec.PodName {
+		return false
+	}
+	if isGatewayPod(pod) {
+		return true
+	}
+	self, err := ict.podLister.Pods(known.FleetboardSystemNamespace).Get(ict.spec.PodName)
+	return err == nil && isGatewayPod(self)
+}
+
+// configBridgeRoutes routes node cidr of another cnf pod over ip-in-ip to its bridge ip, which goes through
+// wire-guard from our own bridge ip.
+func (ict *InnerClusterTunnelController) configBridgeRoutes(podConfig *tunnel.DaemonCNFTunnelConfig,
+	operation known.RouteOperation) error {
+	bridgeIP, err := tunnel.InnerNextHop(ict.spec, podConfig)
+	if err != nil {
+		return err
+	}
+	if operation == known.Delete {
+		if err = tunnel.ConfigIPIPRoutes(podConfig.SecondaryCIDR, bridgeIP, known.Delete); err != nil {
+			return err
+		}
+		return tunnel.ConfigBridgeRoute(bridgeIP, "", known.Delete)
+	}
+	srcIP, err := ict.setIPIPLink()
+	if err != nil {
+		return err
+	}
+	// fails until our bridge is up, the pod is handled again later.
+	if err = tunnel.ConfigBridgeRoute(bridgeIP, srcIP, known.Add); err != nil {
+		return err
+	}
+	return tunnel.ConfigIPIPRoutes(podConfig.SecondaryCIDR, bridgeIP, known.Add)
+}
+
+// syncGatewayRoutes routes the global cidr over all the healthy gateways with ecmp in cnf pods which are not
+// gateways, so losing one gateway only moves its flows to the others.
+func (ict *InnerClusterTunnelController) syncGatewayRoutes(_ context.Context) {
+	self, err := ict.podLister.Pods(known.FleetboardSystemNamespace).Get(ict.spec.PodName)
+	if err != nil {
+		klog.V(4).Infof("can't get cnf pod %s: %v", ict.spec.PodName, err)
+		return
+	}
+	globalCIDR := utils.GetSpecificAnnotation(self, known.FleetboardTunnelCIDR)
+	if len(globalCIDR) == 0 {
+		return
+	}
+	var nextHops []string
+	if !isGatewayPod(self) {
+		// gateways reach other clusters through their own tunnels.
+		if nextHops, err = ict.gatewayNextHops(time.Now()); err != nil {
+			klog.Errorf("can't get next hops of gateways: %v", err)
+			return
+		}
+	}
+	if _, err = ict.setIPIPLink(); err != nil {
+		klog.V(4).Infof("ip-in-ip device is not ready: %v", err)
+		return
+	}
+	if err = tunnel.ConfigMultipathRoute(globalCIDR[0], nextHops); err != nil {
+		klog.Errorf("can't route %s through gateways %v: %v", globalCIDR[0], nextHops, err)
+	}
+}
+
+// gatewayNextHops are next hops of connected gateways which handshake recently, or all the connected ones if
+// none does.
+func (ict *InnerClusterTunnelController) gatewayNextHops(now time.Time) ([]string, error) {
+	var devicePeers map[string]wgtypes.Peer
+	if ict.spec.InnerClusterTransport != tunnel.TransportIPIP {
+		var err error
+		if devicePeers, err = ict.wireguard.DevicePeers(); err != nil {
+			return nil, err
+		}
+	}
+	pods, err := ict.podLister.Pods(known.FleetboardSystemNamespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	connected := make([]string, 0)
+	healthy := make([]string, 0)
+	for _, pod := range pods {
+		if pod.Name == ict.spec.PodName || !isGatewayPod(pod) || !utils.IsPodAlive(pod) {
+			continue
+		}
+		config, found := ict.wireguard.GetExistingInnerConnection(pod.Spec.NodeName)
+		if !found || config.PodID != pod.Name {
+			continue
+		}
+		nextHop, errHop := tunnel.InnerNextHop(ict.spec, config)
+		if errHop != nil {
+			continue
+		}
+		connected = append(connected, nextHop)
+		if devicePeers == nil {
+			// ip-in-ip has no handshake, alive is the best we know.
+			healthy = append(healthy, nextHop)
+		} else if devicePeer, ok := devicePeers[config.PublicKey[0]]; ok && handshakeFresh(devicePeer, now) {
+			healthy = append(healthy, nextHop)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = connected
+	}
+	sort.Strings(healthy)
+	return healthy, nil
+}
@@ -0,0 +1,83 @@
+package tunnels
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+	"github.com/pkg/errors"
+)
+
+const fallbackCheckPeriod = 10 * time.Second
+
+// syncFallbackTransports switches peers serving a fallback transport between udp and fallback, whenever the
+// path in use doesn't handshake within the fallback timeout, so whichever works sticks.
+func (ict *InterClusterTunnelController) syncFallbackTransports(_ context.Context) {
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return
+	}
+	now := time.Now()
+	connections := ict.tunnel.GetAllExistingInterConnection()
+	for id := range ict.fallbackWaitSince {
+		if _, found := connections[id]; !found {
+			delete(ict.fallbackWaitSince, id)
+		}
+	}
+	for id, connection := range connections {
+		if len(connection.Spec.FallbackTransport) == 0 || len(connection.Spec.Endpoint) == 0 {
+			continue
+		}
+		if devicePeer, found := devicePeers[connection.Spec.PublicKey]; found && handshakeFresh(devicePeer, now) {
+			delete(ict.fallbackWaitSince, id)
+			continue
+		}
+		since, waiting := ict.fallbackWaitSince[id]
+		if !waiting {
+			ict.fallbackWaitSince[id] = now
+			continue
+		}
+		if now.Sub(since) < ict.spec.FallbackTimeout {
+			continue
+		}
+		useFallback := ict.router.fallback(id) == nil
+		if err = ict.setFallback(connection, useFallback); err != nil {
+			klog.Errorf("can't switch fallback transport of peer %s to %v: %v", id, useFallback, err)
+		}
+		ict.fallbackWaitSince[id] = now
+	}
+}
+
+// setFallback switches the peer endpoint between its udp endpoint and its fallback transport.
+func (ict *InterClusterTunnelController) setFallback(peer *v1alpha1app.Peer, enable bool) error {
+	id := peer.Spec.ClusterID
+	var path *fallbackPath
+	if enable {
+		if len(peer.Spec.FallbackTransport) == 0 || len(peer.Spec.Endpoint) == 0 {
+			return errors.Errorf("peer %s has no fallback transport", id)
+		}
+		address := fallbackAddress(peer)
+		client, err := tunnel.DialFallback(peer.Spec.FallbackTransport, address)
+		if err != nil {
+			return err
+		}
+		path = &fallbackPath{client: client, address: address}
+	}
+	previous := ict.router.setFallback(id, path)
+	if err := ict.tunnel.Refresh(id); err != nil {
+		ict.router.setFallback(id, previous)
+		if path != nil {
+			_ = path.client.Close()
+		}
+		return err
+	}
+	if previous != nil {
+		_ = previous.client.Close()
+	}
+	klog.Infof("peer %s is reached through fallback transport: %v", id, enable)
+	return nil
+}
@@ -0,0 +1,179 @@
+package tunnels
+
+import (
+	"context"
+	"net"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+const (
+	gatewayServicePollPeriod = 5 * time.Second
+	gatewayServiceTimeout    = 5 * time.Minute
+
+	gatewayPortWireguard = "wireguard"
+	gatewayPortFallback  = "fallback"
+)
+
+// exposeGateway exposes the wire-guard port of the leader through a service and waits for its address,
+// which replaces endpoint and ports this cluster publishes in its peer.
+func (ict *InterClusterTunnelController) exposeGateway(ctx context.Context) error {
+	if err := ict.applyGatewayService(ctx); err != nil {
+		return err
+	}
+	return wait.PollUntilContextTimeout(ctx, gatewayServicePollPeriod, gatewayServiceTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			service, err := ict.localK8sClient.CoreV1().Services(known.FleetboardSystemNamespace).
+				Get(ctx, known.GatewayServiceName, metav1.GetOptions{})
+			if err != nil {
+				klog.Errorf("get gateway service failed: %v", err)
+				return false, nil
+			}
+			endpoint, err := ict.gatewayAddress(ctx, service)
+			if err != nil || len(endpoint) == 0 {
+				klog.Infof("waiting for address of gateway service: %v", err)
+				return false, nil
+			}
+			published := publishedAddress{endpoint: endpoint}
+			for _, port := range service.Spec.Ports {
+				publishedPort := int(port.Port)
+				if service.Spec.Type == v1.ServiceTypeNodePort {
+					publishedPort = int(port.NodePort)
+				}
+				switch port.Name {
+				case gatewayPortWireguard:
+					published.port = publishedPort
+				case gatewayPortFallback:
+					published.fallbackPort = publishedPort
+				}
+			}
+			ict.setPublishedAt(published)
+			klog.Infof("gateway is exposed at %s:%d", published.endpoint, published.port)
+			return true, nil
+		})
+}
+
+// publishedAddress is where other clusters dial us.
+type publishedAddress struct {
+	endpoint     string
+	port         int
+	fallbackPort int
+}
+
+func (ict *InterClusterTunnelController) publishedAt() publishedAddress {
+	ict.publishLock.Lock()
+	defer ict.publishLock.Unlock()
+	return ict.published
+}
+
+func (ict *InterClusterTunnelController) setPublishedAt(published publishedAddress) {
+	ict.publishLock.Lock()
+	defer ict.publishLock.Unlock()
+	ict.published = published
+}
+
+func (ict *InterClusterTunnelController) applyGatewayService(ctx context.Context) error {
+	selector, err := labels.ConvertSelectorToLabelsMap(known.LabelCNFPod)
+	if err != nil {
+		return err
+	}
+	selector[known.LeaderCNFLabelKey] = "true"
+	ports := []v1.ServicePort{{
+		Name:       gatewayPortWireguard,
+		Protocol:   v1.ProtocolUDP,
+		Port:       known.UDPPort,
+		TargetPort: intstr.FromInt(known.UDPPort),
+	}}
+	if len(ict.spec.FallbackTransport) != 0 {
+		ports = append(ports, v1.ServicePort{
+			Name:       gatewayPortFallback,
+			Protocol:   v1.ProtocolTCP,
+			Port:       int32(ict.spec.FallbackPort),
+			TargetPort: intstr.FromInt(ict.spec.FallbackPort),
+		})
+	}
+
+	services := ict.localK8sClient.CoreV1().Services(known.FleetboardSystemNamespace)
+	service, err := services.Get(ctx, known.GatewayServiceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		service = &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      known.GatewayServiceName,
+				Namespace: known.FleetboardSystemNamespace,
+			},
+		}
+	} else if err != nil {
+		return err
+	}
+	service.Spec.Type = v1.ServiceType(ict.spec.GatewayServiceType)
+	service.Spec.Selector = selector
+	// keep source address of peers, wire-guard and hole punching rely on it.
+	service.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeLocal
+	// leader carries traffic while not ready for reasons beside the data plane, like a hub blip or an nri reconnect.
+	service.Spec.PublishNotReadyAddresses = true
+	// node ports are kept across updates.
+	for i := range ports {
+		for _, existing := range service.Spec.Ports {
+			if existing.Name == ports[i].Name && existing.Protocol == ports[i].Protocol {
+				ports[i].NodePort = existing.NodePort
+			}
+		}
+	}
+	service.Spec.Ports = ports
+
+	if len(service.ResourceVersion) == 0 {
+		_, err = services.Create(ctx, service, metav1.CreateOptions{})
+	} else {
+		_, err = services.Update(ctx, service, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// gatewayAddress is ingress ip of a load balancer service, or address of the leader node for a node port one.
+func (ict *InterClusterTunnelController) gatewayAddress(ctx context.Context, service *v1.Service) (string, error) {
+	if service.Spec.Type == v1.ServiceTypeLoadBalancer {
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if len(ingress.IP) != 0 {
+				return ingress.IP, nil
+			}
+			if len(ingress.Hostname) != 0 {
+				// peers dial an ip, some clouds only hand out a hostname.
+				ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", ingress.Hostname)
+				if err != nil || len(ips) == 0 {
+					return "", err
+				}
+				return ips[0].String(), nil
+			}
+		}
+		return "", nil
+	}
+
+	return ict.nodeAddress(ctx, ict.spec.NodeName)
+}
+
+// nodeAddress is the external ip of the node, or its internal ip if it has none.
+func (ict *InterClusterTunnelController) nodeAddress(ctx context.Context, nodeName string) (string, error) {
+	node, err := ict.localK8sClient.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	var internalIP string
+	for _, address := range node.Status.Addresses {
+		switch address.Type {
+		case v1.NodeExternalIP:
+			return address.Address, nil
+		case v1.NodeInternalIP:
+			internalIP = address.Address
+		}
+	}
+	return internalIP, nil
+}
@@ -0,0 +1,88 @@
+package tunnels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+func TestExposeGateway(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "192.168.0.10"},
+			{Type: v1.NodeExternalIP, Address: "1.2.3.4"},
+		}},
+	}
+	newService := func(serviceType v1.ServiceType, ingress ...v1.LoadBalancerIngress) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: known.GatewayServiceName, Namespace: known.FleetboardSystemNamespace,
+				ResourceVersion: "1"},
+			Spec: v1.ServiceSpec{
+				Type: serviceType,
+				Ports: []v1.ServicePort{
+					{Name: gatewayPortWireguard, Protocol: v1.ProtocolUDP, Port: known.UDPPort, NodePort: 31871},
+					{Name: gatewayPortFallback, Protocol: v1.ProtocolTCP, Port: 443, NodePort: 31443},
+				},
+			},
+			Status: v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: ingress}},
+		}
+	}
+	previous := publishedAddress{endpoint: "5.6.7.8", port: known.UDPPort, fallbackPort: 443}
+	tests := []struct {
+		name    string
+		service *v1.Service
+		wantErr bool
+		want    publishedAddress
+	}{
+		{
+			name:    "node port on node address",
+			service: newService(v1.ServiceTypeNodePort),
+			want:    publishedAddress{endpoint: "1.2.3.4", port: 31871, fallbackPort: 31443},
+		},
+		{
+			name:    "load balancer ingress",
+			service: newService(v1.ServiceTypeLoadBalancer, v1.LoadBalancerIngress{IP: "9.9.9.9"}),
+			want:    publishedAddress{endpoint: "9.9.9.9", port: known.UDPPort, fallbackPort: 443},
+		},
+		{
+			name:    "load balancer without address keeps published one",
+			service: newService(v1.ServiceTypeLoadBalancer),
+			wantErr: true,
+			want:    previous,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ict := &InterClusterTunnelController{
+				localK8sClient: fake.NewSimpleClientset(node, tt.service),
+				spec: &tunnel.Specification{
+					Options: tunnel.Options{GatewayServiceType: string(tt.service.Spec.Type),
+						FallbackTransport: tunnel.FallbackTCP, FallbackPort: 443},
+					EnvConfig: known.EnvConfig{NodeName: node.Name},
+				},
+				published: previous,
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err := ict.exposeGateway(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("exposeGateway() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := ict.publishedAt(); got != tt.want {
+				t.Errorf("published at %+v, want %+v", got, tt.want)
+			}
+			service, err := ict.localK8sClient.CoreV1().Services(known.FleetboardSystemNamespace).Get(ctx,
+				known.GatewayServiceName, metav1.GetOptions{})
+			if err != nil || !service.Spec.PublishNotReadyAddresses {
+				t.Errorf("gateway service doesn't publish not ready leader: %v", err)
+			}
+		})
+	}
+}
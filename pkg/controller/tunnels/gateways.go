@@ -0,0 +1,210 @@
+package tunnels
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+	"github.com/fleetboard-io/fleetboard/utils"
+)
+
+const gatewaySyncPeriod = 10 * time.Second
+
+// isGatewayPod tells if the cnf pod holds inter cluster tunnels, the leader or one of the additional gateways.
+func isGatewayPod(pod *v1.Pod) bool {
+	return pod.Labels[known.LeaderCNFLabelKey] == "true" || pod.Labels[known.GatewayCNFLabelKey] == "true"
+}
+
+// syncGateways runs in leader, it picks additional gateways among cnf pods on candidate nodes and publishes them
+// in our peer. Gateways keep the role while they are candidates, so other cnf pods never lose a working path.
+func (ict *InterClusterTunnelController) syncGateways(ctx context.Context) {
+	pods, err := ict.localK8sClient.CoreV1().Pods(known.FleetboardSystemNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: known.LabelCNFPod,
+	})
+	if err != nil {
+		klog.Errorf("can't list cnf pods for gateways: %v", err)
+		return
+	}
+	kept, promoted, revoked := chooseGateways(ict.spec.PodName, pods.Items, ict.spec.GatewayReplicas-1)
+	for _, pod := range revoked {
+		if errLabel := utils.UpdatePodLabel(ict.localK8sClient, pod.Name, known.GatewayCNFLabelKey,
+			false); errLabel != nil {
+			klog.Errorf("can't revoke gateway role of %s: %v", pod.Name, errLabel)
+			continue
+		}
+		klog.Infof("cnf pod %s on node %s is no longer a gateway", pod.Name, pod.Spec.NodeName)
+	}
+	gateways := kept
+	for _, pod := range promoted {
+		if errLabel := utils.UpdatePodLabel(ict.localK8sClient, pod.Name, known.GatewayCNFLabelKey, true); errLabel != nil {
+			klog.Errorf("can't make %s a gateway: %v", pod.Name, errLabel)
+			continue
+		}
+		klog.Infof("cnf pod %s on node %s becomes a gateway", pod.Name, pod.Spec.NodeName)
+		gateways = append(gateways, pod)
+	}
+
+	specs := make([]v1alpha1app.GatewaySpec, 0, len(gateways))
+	for _, pod := range gateways {
+		gateway := v1alpha1app.GatewaySpec{
+			Name:      pod.Spec.NodeName,
+			PublicKey: utils.GetSpecificAnnotation(pod, known.PublicKey)[0],
+		}
+		if next := pod.Annotations[known.NextPublicKey]; next != gateway.PublicKey {
+			gateway.NextPublicKey = next
+		}
+		if len(ict.publishedAt().endpoint) != 0 {
+			// public cluster, the gateway is dialed at its node like the leader.
+			if gateway.Endpoint, err = ict.nodeAddress(ctx, pod.Spec.NodeName); err != nil {
+				klog.Errorf("can't get address of gateway %s: %v", pod.Name, err)
+				continue
+			}
+			gateway.Port = known.UDPPort
+		}
+		specs = append(specs, gateway)
+	}
+
+	ict.gatewayLock.Lock()
+	changed := !equality.Semantic.DeepEqual(ict.gateways, specs)
+	ict.gateways = specs
+	ict.gatewayLock.Unlock()
+	if !changed {
+		return
+	}
+	klog.Infof("publishing %d additional gateways", len(specs))
+	if err = ict.ApplyPeerConfig(); err != nil {
+		klog.Errorf("can't publish gateways in hub: %v", err)
+	}
+}
+
+// chooseGateways keeps up to replicas gateways among alive cnf pods on candidate nodes, ordered by name. Gateways
+// are kept first, then candidates are promoted. Gateways not on a candidate node any more, or beyond replicas, are
+// revoked.
+func chooseGateways(self string, pods []v1.Pod, replicas int) (kept, promoted, revoked []*v1.Pod) {
+	sorted := make([]*v1.Pod, 0, len(pods))
+	for i := range pods {
+		sorted = append(sorted, &pods[i])
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	candidates := make([]*v1.Pod, 0)
+	for _, pod := range sorted {
+		// pods not ready to carry traffic are left as they are.
+		if pod.Name == self || !utils.IsPodAlive(pod) || len(utils.GetSpecificAnnotation(pod, known.PublicKey)) == 0 {
+			continue
+		}
+		gateway := pod.Labels[known.GatewayCNFLabelKey] == "true"
+		candidate := pod.Labels[known.GatewayCandidateLabelKey] == "true"
+		switch {
+		case gateway && candidate && len(kept) < replicas:
+			kept = append(kept, pod)
+		case gateway:
+			revoked = append(revoked, pod)
+		case candidate:
+			candidates = append(candidates, pod)
+		}
+	}
+	for _, pod := range candidates {
+		if len(kept)+len(promoted) >= replicas {
+			break
+		}
+		promoted = append(promoted, pod)
+	}
+	return kept, promoted, revoked
+}
+
+// PublishGatewayKey updates keys of this additional gateway in our peer in key rotation, leader publishes the
+// same keys from the pod annotations later. Nothing is done if leader has not published this gateway yet.
+func (ict *InterClusterTunnelController) PublishGatewayKey(publicKey, nextPublicKey string) error {
+	peers := ict.fleetboardClient.FleetboardV1alpha1().Peers(ict.spec.ShareNamespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		peer, err := peers.Get(context.TODO(), ict.spec.ClusterID, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range peer.Spec.Gateways {
+			gateway := &peer.Spec.Gateways[i]
+			if gateway.Name != ict.spec.NodeName {
+				continue
+			}
+			if gateway.PublicKey == publicKey && gateway.NextPublicKey == nextPublicKey {
+				return nil
+			}
+			gateway.PublicKey = publicKey
+			gateway.NextPublicKey = nextPublicKey
+			_, err = peers.Update(context.TODO(), peer, metav1.UpdateOptions{})
+			return err
+		}
+		return nil
+	})
+}
+
+// syncActiveGateways routes cidrs of peers with more than one gateway through one healthy gateway each.
+func (ict *InterClusterTunnelController) syncActiveGateways(_ context.Context) {
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return
+	}
+	now := time.Now()
+	for id, connection := range ict.tunnel.GetAllExistingInterConnection() {
+		if len(connection.Spec.Gateways) == 0 {
+			continue
+		}
+		active := chooseActiveGateway(ict.spec.ClusterID, connection, devicePeers, ict.router.activeGateway(connection),
+			now)
+		if err = ict.setActiveGateway(connection, active); err != nil {
+			klog.Errorf("can't switch active gateway of peer %s: %v", id, err)
+		}
+	}
+}
+
+// setActiveGateway moves cidrs of peer to one of its gateways. Like hubs, wire-guard allows one peer per
+// allowed ip, so the other gateways of peer stay connected without allowed ips.
+func (ict *InterClusterTunnelController) setActiveGateway(peer *v1alpha1app.Peer, publicKey string) error {
+	previous, changed := ict.router.setActiveGateway(peer, publicKey)
+	if !changed {
+		return nil
+	}
+	if err := ict.tunnel.Refresh(peer.Spec.ClusterID); err != nil {
+		ict.router.setActiveGateway(peer, previous)
+		return err
+	}
+	klog.Infof("active gateway of peer %s switched from %s to %s", peer.Spec.ClusterID, previous, publicKey)
+	return nil
+}
+
+// chooseActiveGateway picks one of the healthy gateways of peer by hash of our cluster id, so traffic of different
+// clusters into peer spreads over its gateways. If no gateway is healthy, current one is kept.
+func chooseActiveGateway(localID string, peer *v1alpha1app.Peer, devicePeers map[string]wgtypes.Peer,
+	current string, now time.Time) string {
+	keys := tunnel.GatewayKeys(peer)
+	healthy := make([]string, 0, len(keys))
+	fallback := keys[0]
+	for _, key := range keys {
+		if key == current {
+			fallback = current
+		}
+		if devicePeer, found := devicePeers[key]; found && handshakeFresh(devicePeer, now) {
+			healthy = append(healthy, key)
+		}
+	}
+	if len(healthy) == 0 {
+		return fallback
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(localID))
+	return healthy[h.Sum32()%uint32(len(healthy))]
+}
@@ -0,0 +1,180 @@
+package tunnels
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+func Test_chooseActiveGateway(t *testing.T) {
+	now := time.Now()
+	peer := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{
+		ClusterID: "cluster-x",
+		PublicKey: "key-a",
+		Gateways: []v1alpha1app.GatewaySpec{
+			{Name: "node-b", PublicKey: "key-b"},
+			{Name: "node-c", PublicKey: "key-c"},
+		},
+	}}
+	fresh := wgtypes.Peer{LastHandshakeTime: now.Add(-time.Minute)}
+	stale := wgtypes.Peer{LastHandshakeTime: now.Add(-10 * time.Minute)}
+	allFresh := map[string]wgtypes.Peer{"key-a": fresh, "key-b": fresh, "key-c": fresh}
+	tests := []struct {
+		name        string
+		localID     string
+		devicePeers map[string]wgtypes.Peer
+		current     string
+		want        string
+	}{
+		{
+			name:        "clusters spread over healthy gateways",
+			localID:     "cluster-1",
+			devicePeers: allFresh,
+			want:        "key-c",
+		},
+		{
+			name:        "another cluster picks another gateway",
+			localID:     "cluster-3",
+			devicePeers: allFresh,
+			want:        "key-a",
+		},
+		{
+			name:        "fail over from stale gateway",
+			localID:     "cluster-1",
+			devicePeers: map[string]wgtypes.Peer{"key-a": stale, "key-b": fresh, "key-c": stale},
+			current:     "key-c",
+			want:        "key-b",
+		},
+		{
+			name:        "keep current when no gateway is healthy",
+			localID:     "cluster-1",
+			devicePeers: map[string]wgtypes.Peer{"key-a": stale, "key-b": stale},
+			current:     "key-b",
+			want:        "key-b",
+		},
+		{
+			name:        "gateway in peer spec by default",
+			localID:     "cluster-1",
+			devicePeers: map[string]wgtypes.Peer{},
+			want:        "key-a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseActiveGateway(tt.localID, peer, tt.devicePeers, tt.current, now)
+			if got != tt.want {
+				t.Errorf("chooseActiveGateway() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_chooseGateways(t *testing.T) {
+	newPod := func(name string, gateway, candidate, deleting bool) v1.Pod {
+		pod := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{},
+				Annotations: map[string]string{known.PublicKey: "key-" + name}},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		}
+		if deleting {
+			pod.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+		if gateway {
+			pod.Labels[known.GatewayCNFLabelKey] = "true"
+		}
+		if candidate {
+			pod.Labels[known.GatewayCandidateLabelKey] = "true"
+		}
+		return pod
+	}
+	names := func(pods []*v1.Pod) []string {
+		result := make([]string, 0, len(pods))
+		for _, pod := range pods {
+			result = append(result, pod.Name)
+		}
+		return result
+	}
+	tests := []struct {
+		name         string
+		pods         []v1.Pod
+		replicas     int
+		wantKept     []string
+		wantPromoted []string
+		wantRevoked  []string
+	}{
+		{
+			name: "candidates promoted by name",
+			pods: []v1.Pod{
+				newPod("leader", false, true, false),
+				newPod("cnf-c", false, true, false),
+				newPod("cnf-b", false, true, false),
+				newPod("cnf-a", false, false, false),
+			},
+			replicas:     1,
+			wantKept:     []string{},
+			wantPromoted: []string{"cnf-b"},
+			wantRevoked:  []string{},
+		},
+		{
+			name: "gateways kept before candidates",
+			pods: []v1.Pod{
+				newPod("cnf-b", false, true, false),
+				newPod("cnf-c", true, true, false),
+			},
+			replicas:     1,
+			wantKept:     []string{"cnf-c"},
+			wantPromoted: []string{},
+			wantRevoked:  []string{},
+		},
+		{
+			name: "gateway no longer a candidate is revoked and replaced",
+			pods: []v1.Pod{
+				newPod("cnf-b", true, false, false),
+				newPod("cnf-c", false, true, false),
+			},
+			replicas:     1,
+			wantKept:     []string{},
+			wantPromoted: []string{"cnf-c"},
+			wantRevoked:  []string{"cnf-b"},
+		},
+		{
+			name: "gateways beyond replicas are revoked",
+			pods: []v1.Pod{
+				newPod("cnf-b", true, true, false),
+				newPod("cnf-c", true, true, false),
+			},
+			replicas:     1,
+			wantKept:     []string{"cnf-b"},
+			wantPromoted: []string{},
+			wantRevoked:  []string{"cnf-c"},
+		},
+		{
+			name: "gateway being deleted is left alone",
+			pods: []v1.Pod{
+				newPod("cnf-b", true, true, true),
+				newPod("cnf-c", false, true, false),
+			},
+			replicas:     1,
+			wantKept:     []string{},
+			wantPromoted: []string{"cnf-c"},
+			wantRevoked:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, promoted, revoked := chooseGateways("leader", tt.pods, tt.replicas)
+			if !reflect.DeepEqual(names(kept), tt.wantKept) || !reflect.DeepEqual(names(promoted), tt.wantPromoted) ||
+				!reflect.DeepEqual(names(revoked), tt.wantRevoked) {
+				t.Errorf("chooseGateways() = %v %v %v, want %v %v %v", names(kept), names(promoted), names(revoked),
+					tt.wantKept, tt.wantPromoted, tt.wantRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package tunnels
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+const directPathCheckPeriod = 10 * time.Second
+
+// syncDirectPaths moves traffic of hole punched peers to the direct tunnel once it handshakes,
+// and back to hub when the handshake goes stale.
+func (ict *InterClusterTunnelController) syncDirectPaths(_ context.Context) {
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return
+	}
+	now := time.Now()
+	for id, connection := range ict.tunnel.GetAllExistingInterConnection() {
+		if !tunnel.HolePunchingPeer(ict.spec, connection) {
+			continue
+		}
+		devicePeer, found := devicePeers[connection.Spec.PublicKey]
+		direct := found && handshakeFresh(devicePeer, now)
+		if err = ict.setDirectPath(connection, direct); err != nil {
+			klog.Errorf("can't set direct path of peer %s: %v", id, err)
+		}
+	}
+}
+
+// setDirectPath routes the cidr of a hole punched peer straight to it, or back through hub when direct is false.
+// Until then the peer is on the device without allowed ips, so keepalives punch the nat but carry no traffic.
+func (ict *InterClusterTunnelController) setDirectPath(peer *v1alpha1app.Peer, direct bool) error {
+	endpoint := ""
+	if direct {
+		endpoint = peer.Status.ObservedEndpoint
+	}
+	previous, changed := ict.router.setDirectPath(peer.Spec.ClusterID, endpoint)
+	if !changed {
+		return nil
+	}
+	if err := ict.tunnel.Refresh(peer.Spec.ClusterID); err != nil {
+		ict.router.setDirectPath(peer.Spec.ClusterID, previous)
+		return err
+	}
+	klog.Infof("direct path to %s is set to %v", peer.Spec.ClusterID, direct)
+	return nil
+}
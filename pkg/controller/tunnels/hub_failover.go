@@ -0,0 +1,154 @@
+package tunnels
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+const (
+	hubFailoverPeriod   = 10 * time.Second
+	primaryHubLeaseName = "fleetboard-primary-hub"
+)
+
+// primaryHubLease is how long the primary hub holds its lease without renewing it.
+var primaryHubLease = struct {
+	duration, renewDeadline, retryPeriod time.Duration
+}{
+	duration:      15 * time.Second,
+	renewDeadline: 10 * time.Second,
+	retryPeriod:   2 * time.Second,
+}
+
+// syncActiveHub fails the global cidr over to another hub when the active one stops handshaking.
+func (ict *InterClusterTunnelController) syncActiveHub(_ context.Context) {
+	hubs := make([]*v1alpha1app.Peer, 0)
+	for _, connection := range ict.tunnel.GetAllExistingInterConnection() {
+		if connection.Spec.IsHub {
+			hubs = append(hubs, connection)
+		}
+	}
+	if len(hubs) == 0 {
+		return
+	}
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return
+	}
+	active := chooseActiveHub(hubs, devicePeers, ict.router.hub(), time.Now())
+	if len(active) == 0 {
+		return
+	}
+	if err = ict.setActiveHub(active); err != nil {
+		klog.Errorf("can't switch active hub to %s: %v", active, err)
+	}
+}
+
+// setActiveHub moves the global cidr to the given hub. All hubs advertise the same global cidr, but wire-guard
+// allows one peer per allowed ip, so the other hubs stay connected as standby without allowed ips.
+func (ict *InterClusterTunnelController) setActiveHub(clusterID string) error {
+	previous, changed := ict.router.setActiveHub(clusterID)
+	if !changed {
+		return nil
+	}
+	// active hub goes last, so it ends up owning the global cidr.
+	if err := ict.tunnel.Refresh(previous, clusterID); err != nil {
+		ict.router.setActiveHub(previous)
+		return err
+	}
+	klog.Infof("active hub switched from %q to %q", previous, clusterID)
+	return nil
+}
+
+// chooseActiveHub picks the first healthy hub ordered by cluster id, so all child clusters agree on the same hub
+// and return traffic comes back through the hub it was sent to. If no hub is healthy, current one is kept.
+func chooseActiveHub(hubs []*v1alpha1app.Peer, devicePeers map[string]wgtypes.Peer, current string,
+	now time.Time) string {
+	sorted := make([]*v1alpha1app.Peer, len(hubs))
+	copy(sorted, hubs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Spec.ClusterID < sorted[j].Spec.ClusterID
+	})
+
+	fallback := ""
+	for _, hub := range sorted {
+		devicePeer, found := devicePeers[hub.Spec.PublicKey]
+		if !found {
+			continue
+		}
+		if handshakeFresh(devicePeer, now) {
+			return hub.Spec.ClusterID
+		}
+		if len(fallback) == 0 || hub.Spec.ClusterID == current {
+			fallback = hub.Spec.ClusterID
+		}
+	}
+	return fallback
+}
+
+// isPrimaryHub tells if this hub owns cidr allocation and peer status, so hubs don't race on writing peers.
+func (ict *InterClusterTunnelController) isPrimaryHub() bool {
+	return ict.primaryHub.Load()
+}
+
+// electPrimaryHub runs for primary hub until ctx is done. The primary hub holds a lease in the shared namespace,
+// once it stops renewing it, e.g. the hub is down, another hub takes it over.
+func (ict *InterClusterTunnelController) electPrimaryHub(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      primaryHubLeaseName,
+			Namespace: ict.spec.ShareNamespace,
+		},
+		// hubs share the hub cluster.
+		Client: ict.localK8sClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			// another cnf pod of the same hub has to wait for the lease as well.
+			Identity: ict.spec.ClusterID + "_" + ict.spec.PodName,
+		},
+	}
+	// run again after losing the lease, the hub may come back.
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   primaryHubLease.duration,
+			RenewDeadline:   primaryHubLease.renewDeadline,
+			RetryPeriod:     primaryHubLease.retryPeriod,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(_ context.Context) {
+					klog.Infof("hub %s is the primary hub now", ict.spec.ClusterID)
+					ict.primaryHub.Store(true)
+				},
+				OnStoppedLeading: func() {
+					klog.Infof("hub %s is no longer the primary hub", ict.spec.ClusterID)
+					ict.primaryHub.Store(false)
+				},
+			},
+		})
+	}, primaryHubLease.retryPeriod)
+}
+
+// otherHubConnected tells if the global cidr is still reachable through a hub other than clusterID.
+func (ict *InterClusterTunnelController) otherHubConnected(clusterID string) bool {
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return false
+	}
+	for id, connection := range ict.tunnel.GetAllExistingInterConnection() {
+		if _, found := devicePeers[connection.Spec.PublicKey]; found && id != clusterID && connection.Spec.IsHub {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package tunnels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+func Test_chooseActiveHub(t *testing.T) {
+	now := time.Now()
+	hubA := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "hub-a", PublicKey: "key-a", IsHub: true}}
+	hubB := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "hub-b", PublicKey: "key-b", IsHub: true}}
+	fresh := wgtypes.Peer{LastHandshakeTime: now.Add(-time.Minute)}
+	stale := wgtypes.Peer{LastHandshakeTime: now.Add(-10 * time.Minute)}
+	tests := []struct {
+		name        string
+		devicePeers map[string]wgtypes.Peer
+		current     string
+		want        string
+	}{
+		{
+			name:        "first healthy hub wins",
+			devicePeers: map[string]wgtypes.Peer{"key-a": fresh, "key-b": fresh},
+			current:     "hub-b",
+			want:        "hub-a",
+		},
+		{
+			name:        "fail over from stale hub",
+			devicePeers: map[string]wgtypes.Peer{"key-a": stale, "key-b": fresh},
+			current:     "hub-a",
+			want:        "hub-b",
+		},
+		{
+			name:        "keep current when no hub is healthy",
+			devicePeers: map[string]wgtypes.Peer{"key-a": stale, "key-b": {}},
+			current:     "hub-b",
+			want:        "hub-b",
+		},
+		{
+			name:        "skip hub not on device",
+			devicePeers: map[string]wgtypes.Peer{"key-b": {}},
+			current:     "hub-a",
+			want:        "hub-b",
+		},
+		{
+			name:        "no hub on device",
+			devicePeers: map[string]wgtypes.Peer{},
+			want:        "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseActiveHub([]*v1alpha1app.Peer{hubB, hubA}, tt.devicePeers, tt.current, now)
+			if got != tt.want {
+				t.Errorf("chooseActiveHub() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElectPrimaryHub(t *testing.T) {
+	lease := primaryHubLease
+	t.Cleanup(func() { primaryHubLease = lease })
+	primaryHubLease.duration = time.Second
+	primaryHubLease.renewDeadline = 500 * time.Millisecond
+	primaryHubLease.retryPeriod = 100 * time.Millisecond
+	// hubs share the hub cluster.
+	client := fake.NewSimpleClientset()
+	newHub := func(clusterID string) *InterClusterTunnelController {
+		return &InterClusterTunnelController{
+			localK8sClient: client,
+			spec: &tunnel.Specification{
+				Options:   tunnel.Options{ShareNamespace: "fleetboard-shared", AsHub: true},
+				EnvConfig: known.EnvConfig{ClusterID: clusterID, PodName: "cnf-0"},
+			},
+		}
+	}
+	waitPrimary := func(hub *InterClusterTunnelController) {
+		t.Helper()
+		if err := wait.PollUntilContextTimeout(context.Background(), 50*time.Millisecond, 5*time.Second, true,
+			func(_ context.Context) (bool, error) {
+				return hub.isPrimaryHub(), nil
+			}); err != nil {
+			t.Fatalf("hub %s never became primary", hub.spec.ClusterID)
+		}
+	}
+
+	hubA, hubB := newHub("hub-a"), newHub("hub-b")
+	ctxA, cancelA := context.WithCancel(context.Background())
+	go hubA.electPrimaryHub(ctxA)
+	waitPrimary(hubA)
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go hubB.electPrimaryHub(ctxB)
+	time.Sleep(3 * primaryHubLease.retryPeriod)
+	if hubB.isPrimaryHub() {
+		t.Fatal("both hubs are primary")
+	}
+
+	// hub-a goes down, hub-b takes over whatever its cluster id is.
+	cancelA()
+	waitPrimary(hubB)
+	if hubA.isPrimaryHub() {
+		t.Error("hub-a is still primary after it's down")
+	}
+}
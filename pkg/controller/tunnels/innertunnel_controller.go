@@ -19,6 +19,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/dixudx/yacht"
+	"github.com/fleetboard-io/fleetboard/pkg/cnf/metrics"
 	"github.com/fleetboard-io/fleetboard/pkg/config"
 	fleetboardClientset "github.com/fleetboard-io/fleetboard/pkg/generated/clientset/versioned"
 	"github.com/fleetboard-io/fleetboard/pkg/known"
@@ -30,7 +31,8 @@ type InnerClusterTunnelController struct {
 	yachtController     *yacht.Controller
 	podLister           listenrv1.PodLister
 	kubeInformerFactory informers.SharedInformerFactory
-	wireguard           *tunnel.Wireguard
+	wireguard           tunnel.TunnelDriver
+	spec                *tunnel.Specification
 	podSynced           cache.InformerSynced
 	existingCIDR        []string
 	clusterCIDR         string
@@ -40,7 +42,7 @@ type InnerClusterTunnelController struct {
 	sync.RWMutex
 }
 
-func NewInnerClusterTunnelController(w *tunnel.Wireguard,
+func NewInnerClusterTunnelController(spec *tunnel.Specification, w tunnel.TunnelDriver,
 	kubeClientSet kubernetes.Interface) (*InnerClusterTunnelController, error) {
 	// only fleetboard system namespace pod is responsible for wire guard
 	k8sInformerFactory := informers.NewSharedInformerFactoryWithOptions(kubeClientSet, 10*time.Minute,
@@ -53,6 +55,7 @@ func NewInnerClusterTunnelController(w *tunnel.Wireguard,
 
 	ictController := &InnerClusterTunnelController{
 		wireguard:           w,
+		spec:                spec,
 		kubeInformerFactory: k8sInformerFactory,
 		podLister:           podInformer.Lister(),
 		podSynced:           podInformer.Informer().HasSynced,
@@ -128,14 +131,25 @@ func (ict *InnerClusterTunnelController) SpawnNewCIDRForNRIPod(pod *v1.Pod) (str
 	}
 
 	ict.existingCIDR = append(ict.existingCIDR, secondaryCIDR)
+	ict.updateCIDRMetrics()
 	return secondaryCIDR, nil
 }
 
+// updateCIDRMetrics caller must hold the lock.
+func (ict *InnerClusterTunnelController) updateCIDRMetrics() {
+	capacity, err := utils.ClusterCIDRCapacity(ict.clusterCIDR)
+	if err != nil {
+		return
+	}
+	metrics.NodeCIDRsAllocated.Set(float64(len(ict.existingCIDR)))
+	metrics.NodeCIDRsAvailable.Set(float64(capacity - len(ict.existingCIDR)))
+}
+
 func (ict *InnerClusterTunnelController) Handle(podKey interface{}) (*time.Duration, error) {
 	requestAfter := 2 * time.Second
 	isLeader := false
 	// it may change when leader changed.
-	isLeader = ict.wireguard.Spec.PodName == ict.currentLeader
+	isLeader = ict.spec.PodName == ict.currentLeader
 	// get pod info
 	key := podKey.(string)
 	namespace, podName, err := cache.SplitMetaNamespaceKey(key)
@@ -151,7 +165,8 @@ func (ict *InnerClusterTunnelController) Handle(podKey interface{}) (*time.Durat
 		}
 		return nil, err
 	}
-	daemonConfig := tunnel.DaemonConfigFromPod(pod, isLeader)
+	// with multiple gateways, every cnf pod is reached at its node cidr.
+	daemonConfig := tunnel.DaemonConfigFromPod(pod, isLeader || ict.spec.MultiGateway())
 	klog.Infof("inner cluster tunnel controller handle pod: %+v", daemonConfig)
 	// pod is been deleting
 	if !utils.IsPodAlive(pod) {
@@ -174,7 +189,7 @@ func (ict *InnerClusterTunnelController) Handle(podKey interface{}) (*time.Durat
 				return &requestAfter, err
 			}
 			klog.Infof("allocate pod %s secondary cidr successfully", key)
-			if daemonConfig.PodID == ict.wireguard.Spec.PodName {
+			if daemonConfig.PodID == ict.spec.PodName {
 				// coming pod is leader, only allocate cidr no need to establish tunnels.
 				return nil, nil
 			}
@@ -206,22 +221,13 @@ func (ict *InnerClusterTunnelController) Handle(podKey interface{}) (*time.Durat
 		}
 	}
 	// itself shouldn't add tunnel connection with itself.
-	if ict.wireguard.Spec.PodName == podName {
+	if ict.spec.PodName == podName {
 		klog.Infof("pod %s is itself, skip", key)
 		return nil, nil
 	}
 
-	if errAddInnerTunnel := ict.wireguard.AddInnerClusterTunnel(daemonConfig); errAddInnerTunnel != nil {
-		klog.Errorf("add inner cluster tunnel failed: %v, retrying", errAddInnerTunnel)
-		return &requestAfter, errAddInnerTunnel
-	}
-	klog.Infof("pod %s inner cluster tunnel has been added successfully", key)
-
-	// add route for target inner cluster tunnel pod
-	if errRoute := configHostRoutingRules(daemonConfig.SecondaryCIDR, known.Add); errRoute != nil {
-		klog.Infof("add route inner cluster in cnf failed for %s, with error %v",
-			daemonConfig.SecondaryCIDR, errRoute)
-		return &requestAfter, errRoute
+	if err = ict.connect(daemonConfig); err != nil {
+		return &requestAfter, err
 	}
 	return nil, nil
 }
@@ -236,26 +242,28 @@ func (ict *InnerClusterTunnelController) RecycleAllResources() {
 
 func (ict *InnerClusterTunnelController) recycleResources(podConfig *tunnel.DaemonCNFTunnelConfig) error {
 	// check if we have had a tunnel for it.
-	_, found := ict.wireguard.GetExistingInnerConnection(podConfig.NodeID)
+	connection, found := ict.wireguard.GetExistingInnerConnection(podConfig.NodeID)
 	if !found {
 		// do nothing if we have not established any tunnel for this node
 		return nil
 	}
 	publicKey := podConfig.PublicKey
-	if oldKey, err := wgtypes.ParseKey(publicKey[0]); err != nil {
+	if _, err := wgtypes.ParseKey(publicKey[0]); err != nil {
 		klog.Infof("Can't parse key for %s with key %s", podConfig.PodID, publicKey)
 		return err
 	} else {
-		ict.Lock()
-		ict.wireguard.DeleteExistingInnerConnection(podConfig.NodeID)
-		utils.RemoveString(ict.existingCIDR, podConfig.SecondaryCIDR[0])
-		ict.Unlock()
-		removeTunnelError := ict.wireguard.RemoveInnerClusterTunnel(&oldKey)
+		// the connection and its cidr are kept until the device is done, so a retry finds them.
+		removeTunnelError := ict.removeTunnel(connection)
 		if removeTunnelError != nil {
 			klog.Infof("failed to remove tunnel for %s on node %s", podConfig.PodID, podConfig.NodeID)
 			return removeTunnelError
 		}
-		if errRemoveRoute := configHostRoutingRules(podConfig.SecondaryCIDR, known.Delete); errRemoveRoute != nil {
+		ict.Lock()
+		ict.wireguard.DeleteExistingInnerConnection(podConfig.NodeID)
+		ict.existingCIDR = utils.RemoveString(ict.existingCIDR, podConfig.SecondaryCIDR[0])
+		ict.updateCIDRMetrics()
+		ict.Unlock()
+		if errRemoveRoute := ict.configInnerClusterRoutes(podConfig, known.Delete); errRemoveRoute != nil {
 			klog.Infof("delete route failed for %v", errRemoveRoute)
 			return errRemoveRoute
 		}
@@ -263,6 +271,49 @@ func (ict *InnerClusterTunnelController) recycleResources(podConfig *tunnel.Daem
 	return nil
 }
 
+// removeTunnel removes keys of the cnf pod from the device, its next key included.
+func (ict *InnerClusterTunnelController) removeTunnel(config *tunnel.DaemonCNFTunnelConfig) error {
+	for _, publicKey := range config.Keys() {
+		key, err := wgtypes.ParseKey(publicKey)
+		if err != nil {
+			return err
+		}
+		if err = ict.wireguard.RemoveInnerClusterTunnel(&key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configInnerClusterRoutes routes cidrs of another cnf pod through wg0, or straight to it in ip-in-ip.
+func (ict *InnerClusterTunnelController) configInnerClusterRoutes(podConfig *tunnel.DaemonCNFTunnelConfig,
+	operation known.RouteOperation) error {
+	if ict.spec.InnerClusterTransport == tunnel.TransportIPIP {
+		if operation == known.Add {
+			if _, err := ict.setIPIPLink(); err != nil {
+				return err
+			}
+		}
+		return tunnel.ConfigIPIPRoutes(podConfig.SecondaryCIDR, podConfig.EndpointIP(), operation)
+	}
+	if ict.spec.MultiGateway() {
+		return ict.configBridgeRoutes(podConfig, operation)
+	}
+	return configHostRoutingRules(podConfig.SecondaryCIDR, operation)
+}
+
+// setIPIPLink sets up the ip-in-ip device from our own next hop, it fails until we have one. local is the next hop.
+func (ict *InnerClusterTunnelController) setIPIPLink() (local string, err error) {
+	self, err := ict.podLister.Pods(known.FleetboardSystemNamespace).Get(ict.spec.PodName)
+	if err != nil {
+		return "", err
+	}
+	if local, err = tunnel.InnerNextHop(ict.spec, tunnel.DaemonConfigFromPod(self, true)); err != nil {
+		return "", err
+	}
+	return local, tunnel.SetIPIPLink(local, ict.spec.InnerClusterTransport != tunnel.TransportIPIP)
+}
+
 func (ict *InnerClusterTunnelController) Start(ctx context.Context) {
 	defer runtime.HandleCrash()
 	ict.kubeInformerFactory.Start(ctx.Done())
@@ -270,10 +321,16 @@ func (ict *InnerClusterTunnelController) Start(ctx context.Context) {
 	go wait.UntilWithContext(ctx, func(ctx context.Context) {
 		ict.yachtController.Run(ctx)
 	}, time.Duration(0))
+	if ict.spec.MultiGateway() {
+		go wait.UntilWithContext(ctx, ict.syncGatewayRoutes, gatewayRouteSyncPeriod)
+	}
 }
 
 func (ict *InnerClusterTunnelController) ShouldHandlerPod(pod *v1.Pod) bool {
-	var myPodName = ict.wireguard.Spec.PodName
+	if ict.spec.MultiGateway() {
+		return ict.shouldHandleGatewayPod(pod)
+	}
+	var myPodName = ict.spec.PodName
 	var currentLeader = ict.GetCurrentLeader()
 	if currentLeader == "" {
 		if pod.Labels[known.LeaderCNFLabelKey] == "true" {
@@ -286,8 +343,8 @@ func (ict *InnerClusterTunnelController) ShouldHandlerPod(pod *v1.Pod) bool {
 		if pod.Labels[known.LeaderCNFLabelKey] == "true" && currentLeader != pod.Name {
 			// leader changed
 			currentLeader = pod.Name
-			klog.Infof("leader has changed, recycle all tunnels and reconnect to new leader")
-			ict.RecycleAllResources()
+			klog.Infof("leader has changed, reconnect to new leader")
+			ict.ReconcileLeader(currentLeader)
 		}
 	}
 
@@ -305,14 +362,17 @@ func (ict *InnerClusterTunnelController) ShouldHandlerPod(pod *v1.Pod) bool {
 // ConfigWithExistingCIDR  only need invoke on cnf pod
 func (ict *InnerClusterTunnelController) ConfigWithExistingCIDR(oClient *fleetboardClientset.Clientset) error {
 	existingCIDR, clusterCIDR, globalCIDR, err := getInnerClusterExistingCIDR(ict.kubeClientSet,
-		oClient, ict.wireguard.Spec)
+		oClient, ict.spec)
 	if err != nil {
 		klog.Errorf("can't get or set annotation with existing cidr and global or cluster cidr")
 		return err
 	}
+	ict.Lock()
+	defer ict.Unlock()
 	ict.existingCIDR = existingCIDR
 	ict.clusterCIDR = clusterCIDR
 	ict.globalCIDR = globalCIDR
+	ict.updateCIDRMetrics()
 	return nil
 }
 
@@ -5,14 +5,18 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sys/unix"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -33,28 +37,61 @@ type InterClusterTunnelController struct {
 	yachtController *yacht.Controller
 	// specific namespace.
 	peerLister        v1alpha1.PeerLister
+	clusterSetLister  v1alpha1.ClusterSetLister
 	fleetboardFactory fleetboardInformers.SharedInformerFactory
-	tunnel            *tunnel.Wireguard
-	fleetboardClient  *versioned.Clientset
+	tunnel            tunnel.TunnelDriver
+	router            *peerRouter
+	fleetboardClient  versioned.Interface
 	spec              *tunnel.Specification
 	localK8sClient    kubernetes.Interface
+	// exchangeKey derives pre-shared keys with peers, loaded from local cluster on first use.
+	exchangeLock sync.Mutex
+	exchangeKey  *wgtypes.Key
+	// peers waiting for a handshake on the path in use, only touched by syncFallbackTransports.
+	fallbackWaitSince map[string]time.Time
+	// cidrs routed to wireguard device for relays, only touched by syncRelayRoutes.
+	relayHostRoutes sets.Set[string]
+	// where other clusters dial us, it differs from spec when exposed through a service.
+	publishLock sync.Mutex
+	published   publishedAddress
+	// leading is set in leader, additional gateways only hold tunnels and never write peers.
+	leading atomic.Bool
+	// serving is set while we hold inter cluster tunnels, in leader or an additional gateway.
+	serving atomic.Bool
+	// primaryHub is set while this hub holds the primary hub lease.
+	primaryHub atomic.Bool
+	runOnce    sync.Once
+	// additional gateways published in peer, only set in leader.
+	gatewayLock sync.Mutex
+	gateways    []v1alpha1app.GatewaySpec
 }
 
 func NewInterClusterTunnelController(spec *tunnel.Specification, localK8sClient kubernetes.Interface,
-	w *tunnel.Wireguard, fleetboardClient *versioned.Clientset,
+	w tunnel.TunnelDriver, fleetboardClient versioned.Interface,
 	fleetboardFactory fleetboardInformers.SharedInformerFactory) (*InterClusterTunnelController, error) {
 	ict := &InterClusterTunnelController{
 		peerLister:        fleetboardFactory.Fleetboard().V1alpha1().Peers().Lister(),
+		clusterSetLister:  fleetboardFactory.Fleetboard().V1alpha1().ClusterSets().Lister(),
 		fleetboardFactory: fleetboardFactory,
 		tunnel:            w,
+		router:            newPeerRouter(spec),
 		fleetboardClient:  fleetboardClient,
 		spec:              spec,
 		localK8sClient:    localK8sClient,
+		fallbackWaitSince: make(map[string]time.Time),
+		relayHostRoutes:   sets.New[string](),
+		published: publishedAddress{
+			endpoint:     spec.Endpoint,
+			port:         known.UDPPort,
+			fallbackPort: spec.FallbackPort,
+		},
 	}
+	w.SetRouter(ict.router)
 	peerInformer := fleetboardFactory.Fleetboard().V1alpha1().Peers()
+	clusterSetInformer := fleetboardFactory.Fleetboard().V1alpha1().ClusterSets()
 
 	yachtController := yacht.NewController("peer").
-		WithCacheSynced(peerInformer.Informer().HasSynced).
+		WithCacheSynced(peerInformer.Informer().HasSynced, clusterSetInformer.Informer().HasSynced).
 		WithHandlerContextFunc(func(ctx context.Context, key interface{}) (*time.Duration, error) {
 			select {
 			case <-ctx.Done():
@@ -71,17 +108,15 @@ func NewInterClusterTunnelController(spec *tunnel.Specification, localK8sClient
 				tempObj = oldObj
 			}
 			// klog.Infof("we got a peer connection %v", tempObj)
+			if oldObj != nil && newObj != nil && onlyPeerStatusChanged(oldObj.(*v1alpha1app.Peer),
+				newObj.(*v1alpha1app.Peer)) {
+				// status is written by hub periodically, nothing to do with the tunnel,
+				// unless it brings a new endpoint to punch.
+				return spec.EnableHolePunching && oldObj.(*v1alpha1app.Peer).Status.ObservedEndpoint !=
+					newObj.(*v1alpha1app.Peer).Status.ObservedEndpoint, nil
+			}
 			if tempObj != nil {
-				newPeer := tempObj.(*v1alpha1app.Peer)
-				// hub connect with nohub, nohub connect with hub.
-				// make sure there is only ONE Hub.
-				// TODO should we create wireguard for public child cluster in hub?
-				if newPeer.Spec.IsHub || (len(newPeer.Spec.Endpoint) != 0 && newPeer.Spec.IsPublic) {
-					return !spec.AsHub, nil
-				} else {
-					// child cluster without public ip
-					return spec.AsHub || len(spec.Endpoint) != 0, nil
-				}
+				return ict.shouldConnect(tempObj.(*v1alpha1app.Peer)), nil
 			}
 			return false, nil
 		})
@@ -89,10 +124,24 @@ func NewInterClusterTunnelController(spec *tunnel.Specification, localK8sClient
 	if err != nil {
 		return nil, err
 	}
+	_, err = clusterSetInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { ict.enqueueAllPeers() },
+		UpdateFunc: func(oldObj, newObj interface{}) { ict.enqueueAllPeers() },
+		DeleteFunc: func(obj interface{}) { ict.enqueueAllPeers() },
+	})
+	if err != nil {
+		return nil, err
+	}
 	ict.yachtController = yachtController
 	return ict, nil
 }
 
+func onlyPeerStatusChanged(oldPeer, newPeer *v1alpha1app.Peer) bool {
+	return !equality.Semantic.DeepEqual(oldPeer.Status, newPeer.Status) &&
+		equality.Semantic.DeepEqual(oldPeer.Spec, newPeer.Spec) &&
+		equality.Semantic.DeepEqual(oldPeer.DeletionTimestamp, newPeer.DeletionTimestamp)
+}
+
 func (ict *InterClusterTunnelController) RecyclePeer(cachedPeer *v1alpha1app.Peer) (*time.Duration, error) {
 	// TODO try to recycle peer in this cnf client.
 	var oldKey wgtypes.Key
@@ -102,10 +151,25 @@ func (ict *InterClusterTunnelController) RecyclePeer(cachedPeer *v1alpha1app.Pee
 		klog.Infof("can't find key for %s with key %s", cachedPeer.Name, cachedPeer.Spec.PublicKey)
 		return &failedPeriod, err
 	}
-	if ict.tunnel.RemoveInterClusterTunnel(&oldKey) != nil {
+	// the connection is kept until the device is done, so a retry finds it. If drift reconciler brings the peer
+	// back in between, it's removed as an orphan next time.
+	if err = ict.tunnel.RemoveInterClusterTunnel(&oldKey); err != nil {
 		return &failedPeriod, err
 	}
-	if errRemoveRoute := configHostRoutingRules(cachedPeer.Spec.PodCIDR, known.Delete); errRemoveRoute != nil {
+	// additional gateways and next keys.
+	for _, key := range tunnel.PeerKeys(cachedPeer)[1:] {
+		if gatewayKey, errKey := wgtypes.ParseKey(key); errKey == nil {
+			if err = ict.tunnel.RemoveInterClusterTunnel(&gatewayKey); err != nil {
+				return &failedPeriod, err
+			}
+		}
+	}
+	ict.tunnel.DeleteExistingInterConnection(cachedPeer.Spec.ClusterID)
+	ict.router.disconnect(cachedPeer.Spec.ClusterID)
+	if cachedPeer.Spec.IsHub && ict.otherHubConnected(cachedPeer.Spec.ClusterID) {
+		// hubs share the global cidr, keep the route and fail over to the remaining hubs.
+		ict.syncActiveHub(context.TODO())
+	} else if errRemoveRoute := configHostRoutingRules(cachedPeer.Spec.PodCIDR, known.Delete); errRemoveRoute != nil {
 		klog.Infof("delete route failed for %v", cachedPeer)
 		return &failedPeriod, errRemoveRoute
 	}
@@ -138,7 +202,19 @@ func (ict *InterClusterTunnelController) Handle(obj interface{}) (requeueAfter *
 	peerTerminating := hubNotExist || cachedPeer.DeletionTimestamp != nil
 	// recycle corresponding endpoint slice.
 	if peerTerminating {
-		return ict.RecyclePeer(cachedPeer)
+		// peer is gone or going, recycle the tunnel with the last known connection, named after its cluster id.
+		connection, connected := ict.tunnel.GetAllExistingInterConnection()[peerName]
+		if !connected {
+			return nil, nil
+		}
+		return ict.RecyclePeer(connection)
+	}
+	if !ict.serving.Load() || !ict.shouldConnect(cachedPeer) {
+		if _, connected := ict.tunnel.GetAllExistingInterConnection()[cachedPeer.Spec.ClusterID]; connected {
+			// gateway role is revoked, or topology has changed and this peer is reached some other way now.
+			return ict.RecyclePeer(cachedPeer)
+		}
+		return nil, nil
 	}
 
 	if ict.spec.AsCluster {
@@ -146,20 +222,25 @@ func (ict *InterClusterTunnelController) Handle(obj interface{}) (requeueAfter *
 		if len(cachedPeer.Spec.PodCIDR) == 0 || len(cachedPeer.Spec.PodCIDR[0]) == 0 {
 			return &failedPeriod, errors.NewServiceUnavailable("cidr is not allocated.")
 		}
-		// other child cluster has public ip.
-		if cachedPeer.Name != known.HubClusterName {
+		// other child cluster has public ip. With multiple gateways, node cidr of a gateway is where other cnf pods
+		// send traffic to, leave it alone.
+		if !cachedPeer.Spec.IsHub && !ict.spec.MultiGateway() {
 			if annoError := utils.AddAnnotationToSelf(ict.localK8sClient, known.FleetboardNodeCIDR, cachedPeer.Spec.PodCIDR[0],
 				true); annoError != nil {
 				return &failedPeriod, errors.NewServiceUnavailable("cidr is not allocated.")
 			}
 		}
 	} else if len(cachedPeer.Spec.PodCIDR) == 0 || len(cachedPeer.Spec.PodCIDR[0]) == 0 {
+		if !ict.isPrimaryHub() {
+			// only the primary hub allocates, wait for it.
+			return &failedPeriod, errors.NewServiceUnavailable("cidr is not allocated.")
+		}
 		//  prepare data...
 		existingCIDR := make([]string, 0)
 		noCIDR = true
 		if peerList, errListPeer := ict.peerLister.Peers(namespace).List(labels.Everything()); errListPeer == nil {
 			for _, item := range peerList {
-				if item.Name != "hub" && len(item.Spec.PodCIDR) != 0 {
+				if !item.Spec.IsHub && len(item.Spec.PodCIDR) != 0 {
 					existingCIDR = append(existingCIDR, item.Spec.PodCIDR[0])
 				}
 			}
@@ -175,7 +256,18 @@ func (ict *InterClusterTunnelController) Handle(obj interface{}) (requeueAfter *
 			return &failedPeriod, err
 		}
 	}
-	if errAddPeer := ict.tunnel.AddInterClusterTunnel(cachedPeer); errAddPeer != nil {
+	if tunnel.HolePunchingPeer(ict.spec, cachedPeer) && len(cachedPeer.Status.ObservedEndpoint) == 0 {
+		// hub has not seen this peer yet, status update will bring it back.
+		klog.V(4).Infof("peer %s has no observed endpoint to punch yet", peerName)
+		return nil, nil
+	}
+	psk, err := ict.presharedKey(cachedPeer)
+	if err != nil {
+		klog.Errorf("get pre-shared key for peer %s failed: %v", peerName, err)
+		return &failedPeriod, err
+	}
+	ict.router.adoptHub(cachedPeer)
+	if errAddPeer := ict.tunnel.AddInterClusterTunnel(cachedPeer, psk); errAddPeer != nil {
 		klog.Infof("add peer failed %v", cachedPeer)
 		return &failedPeriod, errAddPeer
 	}
@@ -198,39 +290,161 @@ func (ict *InterClusterTunnelController) Handle(obj interface{}) (requeueAfter *
 	return nil, nil
 }
 
-func (ict *InterClusterTunnelController) Start(ctx context.Context) {
+// Start publishes our peer and holds inter cluster tunnels while leading, leaseCtx is done once the lease is lost.
+// Tunnels are synced until runCtx is done, so they can be taken up again after StopLeading.
+func (ict *InterClusterTunnelController) Start(runCtx, leaseCtx context.Context) {
 	defer utilruntime.HandleCrash()
 	klog.Info("Starting inter cluster tunnel controller...")
-	err := ict.ApplyPeerConfig()
+	ict.leading.Store(true)
+	ict.serving.Store(true)
+	utils.UpdatePodLabels(ict.localK8sClient, ict.spec.PodName, true)
+	// keep trying as long as we lead, other clusters can't reach us before our peer is published.
+	err := wait.PollUntilContextCancel(leaseCtx, gatewayServicePollPeriod, true, func(ctx context.Context) (bool, error) {
+		if len(ict.spec.GatewayServiceType) != 0 {
+			// leader may have moved to another node, publish where it is exposed now.
+			if errExpose := ict.exposeGateway(ctx); errExpose != nil {
+				klog.Errorf("can't expose gateway through service, retrying: %v", errExpose)
+				return false, nil
+			}
+		}
+		if errApply := ict.ApplyPeerConfig(); errApply != nil {
+			klog.Errorf("can't create or update peer in hub, retrying: %v", errApply)
+			return false, nil
+		}
+		return true, nil
+	})
 	if err != nil {
-		klog.Errorf("can't create or update peer in hub.")
+		klog.Errorf("stop starting inter cluster tunnel controller: %v", err)
 		return
 	}
-	utils.UpdatePodLabels(ict.localK8sClient, ict.tunnel.Spec.PodName, true)
+	ict.runOnce.Do(func() { ict.run(runCtx) })
+	// peers left alone while we were not serving.
+	ict.enqueueAllPeers()
+	if ict.spec.AsHub {
+		go ict.electPrimaryHub(leaseCtx)
+		go wait.UntilWithContext(leaseCtx, ict.syncPeerStatus, peerStatusSyncPeriod)
+	}
+	if ict.spec.MultiGateway() {
+		go wait.UntilWithContext(leaseCtx, ict.syncGateways, gatewaySyncPeriod)
+	}
+	if len(ict.spec.FallbackTransport) != 0 && len(ict.publishedAt().endpoint) != 0 {
+		go func() {
+			if errServe := tunnel.ServeFallback(leaseCtx, ict.spec.FallbackTransport, ict.spec.FallbackPort); errServe != nil {
+				klog.Errorf("fallback transport stopped: %v", errServe)
+			}
+		}()
+	}
+}
+
+// StartGateway holds inter cluster tunnels in an additional gateway, leader publishes it in peer. It takes them
+// up again after StopGateway, ctx has to outlive the gateway role.
+func (ict *InterClusterTunnelController) StartGateway(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	klog.Info("Starting inter cluster tunnel controller as an additional gateway...")
+	ict.serving.Store(true)
+	ict.runOnce.Do(func() { ict.run(ctx) })
+	ict.enqueueAllPeers()
+}
+
+// StopLeading removes inter cluster tunnels once the lease is lost, the new leader or gateways take them over.
+func (ict *InterClusterTunnelController) StopLeading() {
+	klog.Info("Stopping inter cluster tunnels of the former leader...")
+	ict.leading.Store(false)
+	ict.serving.Store(false)
+	ict.RecycleAllResources()
+}
+
+// StopGateway removes inter cluster tunnels once leader revokes the gateway role.
+func (ict *InterClusterTunnelController) StopGateway() {
+	klog.Info("Stopping inter cluster tunnels of the additional gateway...")
+	ict.serving.Store(false)
+	ict.RecycleAllResources()
+}
+
+// run syncs tunnels with peers, it's shared by leader and additional gateways and runs only once.
+func (ict *InterClusterTunnelController) run(ctx context.Context) {
 	ict.fleetboardFactory.Start(ctx.Done())
 	go wait.UntilWithContext(ctx, func(ctx context.Context) {
 		ict.yachtController.Run(ctx)
 	}, time.Duration(0))
+	if !ict.spec.AsHub {
+		go wait.UntilWithContext(ctx, ict.syncActiveHub, hubFailoverPeriod)
+		go wait.UntilWithContext(ctx, ict.syncRelayRoutes, relaySyncPeriod)
+	}
+	if ict.spec.EnableHolePunching {
+		go wait.UntilWithContext(ctx, ict.syncDirectPaths, directPathCheckPeriod)
+	}
+	go wait.UntilWithContext(ctx, ict.syncFallbackTransports, fallbackCheckPeriod)
+	go wait.UntilWithContext(ctx, ict.syncActiveGateways, gatewaySyncPeriod)
+	go func() {
+		<-ctx.Done()
+		ict.router.close()
+	}()
 }
 
 func (ict *InterClusterTunnelController) ApplyPeerConfig() error {
-	w := ict.tunnel
+	spec := ict.spec
+	published := ict.publishedAt()
 	peer := &v1alpha1app.Peer{
 		Spec: v1alpha1app.PeerSpec{
-			ClusterID: w.Spec.ClusterID,
-			PodCIDR:   []string{w.Spec.CIDR},
-			Endpoint:  w.Spec.Endpoint,
-			IsHub:     w.Spec.AsHub,
-			Port:      known.UDPPort,
-			IsPublic:  len(w.Spec.Endpoint) != 0,
-			PublicKey: w.Keys.PublicKey.String(),
+			ClusterID: spec.ClusterID,
+			PodCIDR:   []string{spec.CIDR},
+			Endpoint:  published.endpoint,
+			IsHub:     spec.AsHub,
+			Port:      published.port,
+			IsPublic:  len(published.endpoint) != 0,
+			PublicKey: ict.tunnel.PublicKey().String(),
+			// published ahead of a key rotation, so other clusters are ready when we switch to it.
+			NextPublicKey: ict.tunnel.NextPublicKey(),
 		},
 	}
-	peer.Namespace = w.Spec.ShareNamespace
-	peer.Name = w.Spec.ClusterID
+	if spec.EnablePresharedKey {
+		exchangeKey, err := ict.loadExchangeKey()
+		if err != nil {
+			return err
+		}
+		peer.Spec.PresharedKeyExchange = exchangeKey.PublicKey().String()
+	}
+	ict.gatewayLock.Lock()
+	peer.Spec.Gateways = ict.gateways
+	ict.gatewayLock.Unlock()
+	if len(spec.FallbackTransport) != 0 && len(published.endpoint) != 0 {
+		peer.Spec.FallbackTransport = spec.FallbackTransport
+		peer.Spec.FallbackPort = published.fallbackPort
+	}
+	peer.Namespace = spec.ShareNamespace
+	peer.Name = spec.ClusterID
 	return utils.ApplyPeerWithRetry(ict.fleetboardClient, peer)
 }
 
+// loadExchangeKey returns the key pre-shared keys are derived from, all cnf pods of the cluster share it.
+func (ict *InterClusterTunnelController) loadExchangeKey() (*wgtypes.Key, error) {
+	ict.exchangeLock.Lock()
+	defer ict.exchangeLock.Unlock()
+	if ict.exchangeKey == nil {
+		key, err := tunnel.LoadOrCreateExchangeKey(ict.localK8sClient)
+		if err != nil {
+			return nil, err
+		}
+		ict.exchangeKey = key
+	}
+	return ict.exchangeKey, nil
+}
+
+// presharedKey derives the pre-shared key with peer, it's nil unless both sides use pre-shared keys. No secret
+// of the pair is kept in hub, so other clusters sharing hub can't read it.
+func (ict *InterClusterTunnelController) presharedKey(peer *v1alpha1app.Peer) (*wgtypes.Key, error) {
+	if !ict.spec.EnablePresharedKey || len(peer.Spec.PresharedKeyExchange) == 0 {
+		return nil, nil
+	}
+	exchangeKey, err := ict.loadExchangeKey()
+	if err != nil {
+		return nil, err
+	}
+	return tunnel.DerivePresharedKey(*exchangeKey, peer.Spec.PresharedKeyExchange, ict.spec.ClusterID,
+		peer.Spec.ClusterID)
+}
+
 func (ict *InterClusterTunnelController) RecycleAllResources() {
 	for _, peer := range ict.tunnel.GetAllExistingInterConnection() {
 		if _, err := ict.RecyclePeer(peer); err != nil {
@@ -0,0 +1,217 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	fleetboardfake "github.com/fleetboard-io/fleetboard/pkg/generated/clientset/versioned/fake"
+	fleetboardInformers "github.com/fleetboard-io/fleetboard/pkg/generated/informers/externalversions"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+// fakeDriver only keeps connections, there is no device behind it.
+type fakeDriver struct {
+	sync.Mutex
+	key wgtypes.Key
+	// removeErr fails removing peers from the device.
+	removeErr error
+	inter     map[string]*v1alpha1app.Peer
+	inner     map[string]*tunnel.DaemonCNFTunnelConfig
+}
+
+func newFakeDriver(t *testing.T) *fakeDriver {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeDriver{
+		key:   key,
+		inter: make(map[string]*v1alpha1app.Peer),
+		inner: make(map[string]*tunnel.DaemonCNFTunnelConfig),
+	}
+}
+
+func (d *fakeDriver) Init(_ kubernetes.Interface) error { return nil }
+func (d *fakeDriver) Close() error                      { return nil }
+func (d *fakeDriver) Cleanup() error                    { return nil }
+
+func (d *fakeDriver) AddInterClusterTunnel(peer *v1alpha1app.Peer, _ *wgtypes.Key) error {
+	d.Lock()
+	defer d.Unlock()
+	d.inter[peer.Spec.ClusterID] = peer
+	return nil
+}
+
+func (d *fakeDriver) RemoveInterClusterTunnel(_ *wgtypes.Key) error {
+	d.Lock()
+	defer d.Unlock()
+	return d.removeErr
+}
+
+func (d *fakeDriver) AddInnerClusterTunnel(config *tunnel.DaemonCNFTunnelConfig, _ *wgtypes.Key) error {
+	d.Lock()
+	defer d.Unlock()
+	d.inner[config.NodeID] = config
+	return nil
+}
+
+func (d *fakeDriver) RemoveInnerClusterTunnel(_ *wgtypes.Key) error { return nil }
+
+func (d *fakeDriver) GetAllExistingInterConnection() map[string]*v1alpha1app.Peer {
+	d.Lock()
+	defer d.Unlock()
+	connections := make(map[string]*v1alpha1app.Peer, len(d.inter))
+	for id, peer := range d.inter {
+		connections[id] = peer
+	}
+	return connections
+}
+
+func (d *fakeDriver) GetAllExistingInnerConnection() map[string]*tunnel.DaemonCNFTunnelConfig {
+	d.Lock()
+	defer d.Unlock()
+	connections := make(map[string]*tunnel.DaemonCNFTunnelConfig, len(d.inner))
+	for id, config := range d.inner {
+		connections[id] = config
+	}
+	return connections
+}
+
+func (d *fakeDriver) GetExistingInnerConnection(nodeID string) (*tunnel.DaemonCNFTunnelConfig, bool) {
+	d.Lock()
+	defer d.Unlock()
+	config, found := d.inner[nodeID]
+	return config, found
+}
+
+func (d *fakeDriver) DeleteExistingInnerConnection(nodeID string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.inner, nodeID)
+}
+
+func (d *fakeDriver) DeleteExistingInterConnection(clusterID string) {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.inter, clusterID)
+}
+
+func (d *fakeDriver) SetRouter(_ tunnel.Router)              {}
+func (d *fakeDriver) Refresh(_ ...string) error              { return nil }
+func (d *fakeDriver) PublicKey() wgtypes.Key                 { return d.key.PublicKey() }
+func (d *fakeDriver) NextPublicKey() string                  { return "" }
+func (d *fakeDriver) RotateKey(_ kubernetes.Interface) error { return nil }
+
+func (d *fakeDriver) KeyRotationDue(_ time.Duration, _ time.Time) bool { return false }
+
+func (d *fakeDriver) ConfirmKeyRotation(_ kubernetes.Interface, _ time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (d *fakeDriver) DevicePeers() (map[string]wgtypes.Peer, error) {
+	return map[string]wgtypes.Peer{}, nil
+}
+
+func (d *fakeDriver) Reconcile() ([]tunnel.Drift, error) { return nil, nil }
+
+func (d *fakeDriver) connected(clusterID string) bool {
+	_, found := d.GetAllExistingInterConnection()[clusterID]
+	return found
+}
+
+func TestLeadershipLostAndRegained(t *testing.T) {
+	hubKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &tunnel.Specification{
+		Options:   tunnel.Options{ShareNamespace: "fleetboard-shared", AsCluster: true, GatewayReplicas: 1},
+		EnvConfig: known.EnvConfig{ClusterID: "cluster-1", PodName: "cnf-0"},
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cnf-0", Namespace: known.FleetboardSystemNamespace}}
+	hub := &v1alpha1app.Peer{
+		ObjectMeta: metav1.ObjectMeta{Name: "hub", Namespace: spec.ShareNamespace},
+		Spec: v1alpha1app.PeerSpec{ClusterID: "hub", IsHub: true, Endpoint: "1.1.1.1",
+			PublicKey: hubKey.PublicKey().String(), PodCIDR: []string{"20.112.0.0/12"}},
+	}
+	fleetboardClient := fleetboardfake.NewSimpleClientset(hub)
+	factory := fleetboardInformers.NewSharedInformerFactoryWithOptions(fleetboardClient, known.DefaultResync,
+		fleetboardInformers.WithNamespace(spec.ShareNamespace))
+	driver := newFakeDriver(t)
+	ict, err := NewInterClusterTunnelController(spec, fake.NewSimpleClientset(pod), driver, fleetboardClient,
+		factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitConnected := func(want bool) {
+		t.Helper()
+		if errWait := wait.PollUntilContextTimeout(context.Background(), 50*time.Millisecond, 10*time.Second, true,
+			func(_ context.Context) (bool, error) {
+				return driver.connected("hub") == want, nil
+			}); errWait != nil {
+			t.Fatalf("hub connected = %v, want %v", !want, want)
+		}
+	}
+
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+	leaseCtx, cancelLease := context.WithCancel(runCtx)
+	ict.Start(runCtx, leaseCtx)
+	waitConnected(true)
+
+	// lease is lost.
+	cancelLease()
+	ict.StopLeading()
+	if ict.leading.Load() || ict.serving.Load() {
+		t.Fatalf("leading = %v, serving = %v after losing the lease", ict.leading.Load(), ict.serving.Load())
+	}
+	waitConnected(false)
+
+	// lease is regained, tunnels are synced again.
+	leaseCtx, cancelLease = context.WithCancel(runCtx)
+	defer cancelLease()
+	ict.Start(runCtx, leaseCtx)
+	if !ict.leading.Load() || !ict.serving.Load() {
+		t.Fatalf("leading = %v, serving = %v after regaining the lease", ict.leading.Load(), ict.serving.Load())
+	}
+	waitConnected(true)
+}
+
+func TestRecyclePeerKeepsConnectionOnFailure(t *testing.T) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &tunnel.Specification{Options: tunnel.Options{AsCluster: true}}
+	peer := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "cluster-2",
+		PublicKey: key.PublicKey().String(), PodCIDR: []string{"20.113.0.0/16"}}}
+	driver := newFakeDriver(t)
+	driver.inter[peer.Spec.ClusterID] = peer
+	driver.removeErr = fmt.Errorf("no such device")
+	ict := &InterClusterTunnelController{tunnel: driver, router: newPeerRouter(spec), spec: spec}
+
+	if _, err = ict.RecyclePeer(peer); err == nil {
+		t.Fatal("RecyclePeer() succeeded while the device failed")
+	}
+	if !driver.connected(peer.Spec.ClusterID) {
+		t.Fatal("connection is forgotten, retry can't find it")
+	}
+	// device is fine again, removing the route fails here without wg0, the connection is gone by then.
+	driver.removeErr = nil
+	_, _ = ict.RecyclePeer(peer)
+	if driver.connected(peer.Spec.ClusterID) {
+		t.Error("connection is kept after the device removed the peer")
+	}
+}
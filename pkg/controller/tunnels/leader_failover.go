@@ -0,0 +1,145 @@
+package tunnels
+
+import (
+	"context"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+	"github.com/fleetboard-io/fleetboard/utils"
+)
+
+// staleConnection is an inner connection the new leader doesn't want as it is.
+type staleConnection struct {
+	config *tunnel.DaemonCNFTunnelConfig
+	// removeTunnel is false if the node is still wanted, its tunnel is updated in place.
+	removeTunnel bool
+	// cidrs routed to the connection which no wanted connection routes any more.
+	cidrs []string
+}
+
+// ReconcileLeader switches to a new leader by diffing inner connections against what the new leader wants,
+// wanted ones are connected first, then only stale tunnels and routes are removed. So tunnels and routes
+// which stay the same, like the global cidr in cnf pods which are not leader, keep carrying traffic.
+func (ict *InnerClusterTunnelController) ReconcileLeader(leader string) {
+	ict.SetCurrentLeader(leader)
+	if ict.spec.MultiGateway() {
+		// gateways stay when leader changes.
+		return
+	}
+	pods, err := ict.kubeClientSet.CoreV1().Pods(known.FleetboardSystemNamespace).List(context.TODO(),
+		metav1.ListOptions{LabelSelector: known.RouterCNFCreatedByLabel})
+	if err != nil {
+		klog.Errorf("can't list cnf pods, recycle all tunnels for new leader %s: %v", leader, err)
+		ict.RecycleAllResources()
+		return
+	}
+	desired := desiredConnections(ict.spec.PodName, leader, pods.Items)
+	// snapshot before connecting, connect overwrites connections of nodes whose cidrs change.
+	existing := ict.wireguard.GetAllExistingInnerConnection()
+	for _, config := range desired {
+		if len(config.SecondaryCIDR) == 0 || len(config.ServiceCIDR) == 0 || len(config.PublicKey) == 0 {
+			// not ready yet, it's handled when it is.
+			continue
+		}
+		if errConnect := ict.connect(config); errConnect != nil {
+			klog.Errorf("can't connect with %s for new leader %s: %v", config.PodID, leader, errConnect)
+		}
+	}
+
+	stale := diffConnections(existing, desired)
+	for _, connection := range stale {
+		if errRecycle := ict.recycleStaleConnection(connection); errRecycle != nil {
+			klog.Errorf("can't recycle stale connection with %s: %v", connection.config.PodID, errRecycle)
+		}
+	}
+	klog.Infof("leader switched to %s, %d inner connections wanted, %d stale", leader, len(desired), len(stale))
+}
+
+// desiredConnections are connections of cnf pod self under leader, keyed by node: leader connects with every
+// cnf pod at its node cidr, the others connect with leader for the global cidr.
+func desiredConnections(self, leader string, pods []v1.Pod) map[string]*tunnel.DaemonCNFTunnelConfig {
+	isLeader := self == leader
+	desired := make(map[string]*tunnel.DaemonCNFTunnelConfig)
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Name == self || !utils.IsPodAlive(pod) || !isLeader && pod.Name != leader {
+			continue
+		}
+		config := tunnel.DaemonConfigFromPod(pod, isLeader)
+		desired[config.NodeID] = config
+	}
+	return desired
+}
+
+// diffConnections lists existing connections which differ from desired ones.
+func diffConnections(existing, desired map[string]*tunnel.DaemonCNFTunnelConfig) []staleConnection {
+	wantedCIDRs := sets.New[string]()
+	for _, config := range desired {
+		wantedCIDRs.Insert(config.SecondaryCIDR...)
+	}
+	stale := make([]staleConnection, 0)
+	for nodeID, config := range existing {
+		wanted, found := desired[nodeID]
+		if found && wanted.PodID == config.PodID &&
+			sets.New[string](wanted.SecondaryCIDR...).Equal(sets.New[string](config.SecondaryCIDR...)) {
+			continue
+		}
+		connection := staleConnection{
+			config:       config,
+			removeTunnel: !found,
+			cidrs:        sets.List(sets.New[string](config.SecondaryCIDR...).Difference(wantedCIDRs)),
+		}
+		if !connection.removeTunnel && len(connection.cidrs) == 0 {
+			continue
+		}
+		stale = append(stale, connection)
+	}
+	return stale
+}
+
+func (ict *InnerClusterTunnelController) recycleStaleConnection(connection staleConnection) error {
+	if connection.removeTunnel {
+		ict.wireguard.DeleteExistingInnerConnection(connection.config.NodeID)
+		if err := ict.removeTunnel(connection.config); err != nil {
+			return err
+		}
+	}
+	if len(connection.cidrs) == 0 {
+		return nil
+	}
+	routes := *connection.config
+	routes.SecondaryCIDR = connection.cidrs
+	return ict.configInnerClusterRoutes(&routes, known.Delete)
+}
+
+// connect builds the tunnel with another cnf pod and routes its cidrs.
+func (ict *InnerClusterTunnelController) connect(daemonConfig *tunnel.DaemonCNFTunnelConfig) error {
+	var psk *wgtypes.Key
+	var err error
+	if ict.spec.EnablePresharedKey {
+		if psk, err = tunnel.GetOrCreatePresharedKey(ict.kubeClientSet, known.FleetboardSystemNamespace,
+			ict.spec.NodeName, daemonConfig.NodeID); err != nil {
+			klog.Errorf("get pre-shared key for pod %s failed: %v, retrying", daemonConfig.PodID, err)
+			return err
+		}
+	}
+	if errAddInnerTunnel := ict.wireguard.AddInnerClusterTunnel(daemonConfig, psk); errAddInnerTunnel != nil {
+		klog.Errorf("add inner cluster tunnel failed: %v, retrying", errAddInnerTunnel)
+		return errAddInnerTunnel
+	}
+	klog.Infof("pod %s inner cluster tunnel has been added successfully", daemonConfig.PodID)
+
+	// add route for target inner cluster tunnel pod
+	if errRoute := ict.configInnerClusterRoutes(daemonConfig, known.Add); errRoute != nil {
+		klog.Infof("add route inner cluster in cnf failed for %s, with error %v",
+			daemonConfig.SecondaryCIDR, errRoute)
+		return errRoute
+	}
+	return nil
+}
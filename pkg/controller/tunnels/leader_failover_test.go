@@ -0,0 +1,84 @@
+package tunnels
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+func Test_diffConnections(t *testing.T) {
+	config := func(node, pod string, cidrs ...string) *tunnel.DaemonCNFTunnelConfig {
+		return &tunnel.DaemonCNFTunnelConfig{NodeID: node, PodID: pod, SecondaryCIDR: cidrs}
+	}
+	type stale struct {
+		node         string
+		removeTunnel bool
+		cidrs        []string
+	}
+	tests := []struct {
+		name     string
+		existing map[string]*tunnel.DaemonCNFTunnelConfig
+		desired  map[string]*tunnel.DaemonCNFTunnelConfig
+		want     []stale
+	}{
+		{
+			name:     "unchanged connection is kept",
+			existing: map[string]*tunnel.DaemonCNFTunnelConfig{"node-a": config("node-a", "cnf-a", "10.0.1.0/24")},
+			desired:  map[string]*tunnel.DaemonCNFTunnelConfig{"node-a": config("node-a", "cnf-a", "10.0.1.0/24")},
+			want:     []stale{},
+		},
+		{
+			name: "old leader's global cidr moves to new leader",
+			existing: map[string]*tunnel.DaemonCNFTunnelConfig{
+				"node-a": config("node-a", "cnf-a", "10.0.0.0/16"),
+			},
+			desired: map[string]*tunnel.DaemonCNFTunnelConfig{
+				"node-b": config("node-b", "cnf-b", "10.0.0.0/16"),
+			},
+			want: []stale{{node: "node-a", removeTunnel: true, cidrs: []string{}}},
+		},
+		{
+			name: "new leader keeps node cidrs of followers",
+			existing: map[string]*tunnel.DaemonCNFTunnelConfig{
+				"node-a": config("node-a", "cnf-a", "10.0.0.0/16"),
+			},
+			desired: map[string]*tunnel.DaemonCNFTunnelConfig{
+				"node-a": config("node-a", "cnf-a", "10.0.1.0/24"),
+				"node-c": config("node-c", "cnf-c", "10.0.3.0/24"),
+			},
+			want: []stale{{node: "node-a", removeTunnel: false, cidrs: []string{"10.0.0.0/16"}}},
+		},
+		{
+			name: "leader turned follower drops other followers",
+			existing: map[string]*tunnel.DaemonCNFTunnelConfig{
+				"node-b": config("node-b", "cnf-b", "10.0.2.0/24"),
+				"node-c": config("node-c", "cnf-c", "10.0.3.0/24"),
+			},
+			desired: map[string]*tunnel.DaemonCNFTunnelConfig{
+				"node-b": config("node-b", "cnf-b", "10.0.0.0/16"),
+			},
+			want: []stale{
+				{node: "node-b", removeTunnel: false, cidrs: []string{"10.0.2.0/24"}},
+				{node: "node-c", removeTunnel: true, cidrs: []string{"10.0.3.0/24"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]stale, 0)
+			for _, connection := range diffConnections(tt.existing, tt.desired) {
+				got = append(got, stale{
+					node:         connection.config.NodeID,
+					removeTunnel: connection.removeTunnel,
+					cidrs:        connection.cidrs,
+				})
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].node < got[j].node })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffConnections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
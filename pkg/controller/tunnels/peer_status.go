@@ -0,0 +1,106 @@
+package tunnels
+
+import (
+	"context"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+const (
+	peerStatusSyncPeriod = 30 * time.Second
+	// wire-guard re-handshakes every 2 minutes on a live tunnel, give it one more minute before we call it stale.
+	handshakeStaleThreshold = 3 * time.Minute
+)
+
+// syncPeerStatus writes tunnel health of every connected peer back to hub, only leader of the primary hub does it,
+// because hub is the only one connecting with all the clusters.
+func (ict *InterClusterTunnelController) syncPeerStatus(ctx context.Context) {
+	if !ict.isPrimaryHub() {
+		return
+	}
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, connection := range ict.tunnel.GetAllExistingInterConnection() {
+		cachedPeer, errGet := ict.peerLister.Peers(ict.spec.ShareNamespace).Get(connection.Name)
+		if errGet != nil {
+			klog.V(5).Infof("can't get peer %s for status update: %v", connection.Name, errGet)
+			continue
+		}
+		devicePeer, found := devicePeers[connection.Spec.PublicKey]
+		status := peerStatusFromDevice(cachedPeer, devicePeer, found, now)
+		if equality.Semantic.DeepEqual(cachedPeer.Status, status) {
+			continue
+		}
+		peer := cachedPeer.DeepCopy()
+		peer.Status = status
+		if _, errUpdate := ict.fleetboardClient.FleetboardV1alpha1().Peers(peer.Namespace).
+			UpdateStatus(ctx, peer, metav1.UpdateOptions{}); errUpdate != nil {
+			klog.Errorf("update status of peer %s failed: %v", peer.Name, errUpdate)
+		}
+	}
+}
+
+// handshakeFresh tells if the tunnel with devicePeer is alive.
+func handshakeFresh(devicePeer wgtypes.Peer, now time.Time) bool {
+	return !devicePeer.LastHandshakeTime.IsZero() && now.Sub(devicePeer.LastHandshakeTime) <= handshakeStaleThreshold
+}
+
+func peerStatusFromDevice(peer *v1alpha1app.Peer, devicePeer wgtypes.Peer, found bool,
+	now time.Time) v1alpha1app.PeerStatus {
+	status := *peer.Status.DeepCopy()
+	connected := metav1.Condition{
+		Type:               v1alpha1app.PeerConditionConnected,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: peer.Generation,
+	}
+	stale := metav1.Condition{
+		Type:               v1alpha1app.PeerConditionHandshakeStale,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: peer.Generation,
+	}
+
+	switch {
+	case !found:
+		connected.Reason, connected.Message = "PeerNotConfigured", "peer is not configured on wireguard device"
+		stale.Reason = "PeerNotConfigured"
+		status.ObservedEndpoint = ""
+		status.ReceiveBytes, status.TransmitBytes = 0, 0
+	case devicePeer.LastHandshakeTime.IsZero():
+		connected.Reason, connected.Message = "NoHandshake", "no handshake has completed with peer yet"
+		stale.Reason = "NoHandshake"
+	case now.Sub(devicePeer.LastHandshakeTime) > handshakeStaleThreshold:
+		connected.Reason = "HandshakeStale"
+		connected.Message = "last handshake is older than " + handshakeStaleThreshold.String()
+		stale.Status, stale.Reason, stale.Message = metav1.ConditionTrue, "HandshakeStale", connected.Message
+	default:
+		connected.Status, connected.Reason = metav1.ConditionTrue, "HandshakeCompleted"
+		stale.Reason = "HandshakeCompleted"
+	}
+
+	if found {
+		if !devicePeer.LastHandshakeTime.IsZero() {
+			// handshake time on the device is in nano seconds, but apiserver only keeps seconds.
+			status.LastHandshakeTime = &metav1.Time{Time: devicePeer.LastHandshakeTime.Truncate(time.Second)}
+		}
+		status.ReceiveBytes = devicePeer.ReceiveBytes
+		status.TransmitBytes = devicePeer.TransmitBytes
+		if devicePeer.Endpoint != nil {
+			status.ObservedEndpoint = devicePeer.Endpoint.String()
+		}
+	}
+
+	meta.SetStatusCondition(&status.Conditions, connected)
+	meta.SetStatusCondition(&status.Conditions, stale)
+	return status
+}
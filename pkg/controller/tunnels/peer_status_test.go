@@ -0,0 +1,71 @@
+package tunnels
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+func Test_peerStatusFromDevice(t *testing.T) {
+	now := time.Now()
+	endpoint := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 31820}
+	tests := []struct {
+		name       string
+		devicePeer wgtypes.Peer
+		found      bool
+		connected  bool
+		stale      bool
+		endpoint   string
+	}{
+		{
+			name:  "not configured",
+			found: false,
+		},
+		{
+			name:       "no handshake",
+			devicePeer: wgtypes.Peer{Endpoint: endpoint},
+			found:      true,
+			endpoint:   "10.0.0.1:31820",
+		},
+		{
+			name:       "stale handshake",
+			devicePeer: wgtypes.Peer{Endpoint: endpoint, LastHandshakeTime: now.Add(-10 * time.Minute)},
+			found:      true,
+			stale:      true,
+			endpoint:   "10.0.0.1:31820",
+		},
+		{
+			name: "connected",
+			devicePeer: wgtypes.Peer{Endpoint: endpoint, LastHandshakeTime: now.Add(-time.Minute),
+				ReceiveBytes: 10, TransmitBytes: 20},
+			found:     true,
+			connected: true,
+			endpoint:  "10.0.0.1:31820",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := peerStatusFromDevice(&v1alpha1app.Peer{}, tt.devicePeer, tt.found, now)
+			if got := meta.IsStatusConditionTrue(status.Conditions,
+				v1alpha1app.PeerConditionConnected); got != tt.connected {
+				t.Errorf("Connected = %v, want %v", got, tt.connected)
+			}
+			if got := meta.IsStatusConditionTrue(status.Conditions,
+				v1alpha1app.PeerConditionHandshakeStale); got != tt.stale {
+				t.Errorf("HandshakeStale = %v, want %v", got, tt.stale)
+			}
+			if status.ObservedEndpoint != tt.endpoint {
+				t.Errorf("ObservedEndpoint = %v, want %v", status.ObservedEndpoint, tt.endpoint)
+			}
+			if status.ReceiveBytes != tt.devicePeer.ReceiveBytes || status.TransmitBytes != tt.devicePeer.TransmitBytes {
+				t.Errorf("bytes = %d/%d, want %d/%d", status.ReceiveBytes, status.TransmitBytes,
+					tt.devicePeer.ReceiveBytes, tt.devicePeer.TransmitBytes)
+			}
+		})
+	}
+}
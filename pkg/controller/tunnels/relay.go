@@ -0,0 +1,192 @@
+package tunnels
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+)
+
+const relaySyncPeriod = 30 * time.Second
+
+// syncRelayRoutes advertises peers we have live tunnels with, and when no hub is alive, routes clusters
+// out of reach through the peers advertising them. Replies only come back the same way if the other side
+// has lost hub as well, which is what a hub outage looks like.
+func (ict *InterClusterTunnelController) syncRelayRoutes(ctx context.Context) {
+	devicePeers, err := ict.tunnel.DevicePeers()
+	if err != nil {
+		klog.Errorf("can't get wireguard device peers: %v", err)
+		return
+	}
+	now := time.Now()
+	live := make([]string, 0)
+	hubAlive := false
+	for id, connection := range ict.tunnel.GetAllExistingInterConnection() {
+		devicePeer, found := devicePeers[connection.Spec.PublicKey]
+		if !found || !handshakeFresh(devicePeer, now) {
+			continue
+		}
+		if connection.Spec.IsHub {
+			hubAlive = true
+			continue
+		}
+		live = append(live, id)
+	}
+	sort.Strings(live)
+	if ict.leading.Load() {
+		ict.advertiseReachablePeers(ctx, live)
+	}
+
+	var relays map[string][]string
+	if !hubAlive {
+		peers, errList := ict.peerLister.Peers(ict.spec.ShareNamespace).List(labels.Everything())
+		if errList != nil {
+			klog.Errorf("can't list peers: %v", errList)
+			return
+		}
+		relays = computeRelayRoutes(ict.spec.ClusterID, live, peers)
+	}
+	if err = ict.setRelayRoutes(relays); err != nil {
+		klog.Errorf("can't set relay routes: %v", err)
+		return
+	}
+	ict.syncRelayHostRoutes(relays)
+}
+
+// syncRelayHostRoutes routes relayed cidrs to the wireguard device, and removes routes of cidrs not relayed any
+// more, unless they belong to a peer we connect with directly now.
+func (ict *InterClusterTunnelController) syncRelayHostRoutes(relays map[string][]string) {
+	routed := sets.New[string]()
+	for _, cidrs := range relays {
+		routed.Insert(cidrs...)
+	}
+	for _, cidr := range sets.List(routed) {
+		if errRoute := configHostRoutingRules([]string{cidr}, known.Add); errRoute != nil {
+			klog.Errorf("add relay route for %s failed: %v", cidr, errRoute)
+		}
+	}
+	for _, cidr := range staleRelayRoutes(ict.relayHostRoutes, routed, ict.tunnel.GetAllExistingInterConnection()) {
+		errRoute := configHostRoutingRules([]string{cidr}, known.Delete)
+		if errRoute != nil && !errors.Is(errRoute, unix.ESRCH) {
+			klog.Errorf("delete relay route for %s failed: %v", cidr, errRoute)
+			// try again next time.
+			routed.Insert(cidr)
+		}
+	}
+	ict.relayHostRoutes = routed
+}
+
+// staleRelayRoutes are cidrs routed for relays before but not any more, cidrs of connected peers keep their
+// routes.
+func staleRelayRoutes(previous, routed sets.Set[string], connections map[string]*v1alpha1app.Peer) []string {
+	stale := previous.Difference(routed)
+	for _, connection := range connections {
+		stale.Delete(connection.Spec.PodCIDR...)
+	}
+	return sets.List(stale)
+}
+
+// setRelayRoutes widens allowed ips of relay peers with cidrs of clusters we can only reach through them,
+// relays is keyed by relay cluster id, nil means no relay is needed.
+func (ict *InterClusterTunnelController) setRelayRoutes(relays map[string][]string) error {
+	previous, changed := ict.router.setRelayedCIDRs(relays)
+	if !changed {
+		return nil
+	}
+	affected := make([]string, 0, len(previous)+len(relays))
+	for id := range previous {
+		affected = append(affected, id)
+	}
+	for id := range relays {
+		if _, found := previous[id]; !found {
+			affected = append(affected, id)
+		}
+	}
+	if err := ict.tunnel.Refresh(affected...); err != nil {
+		ict.router.setRelayedCIDRs(previous)
+		return err
+	}
+	klog.Infof("relay routes are set to %v", relays)
+	return nil
+}
+
+// advertiseReachablePeers writes peers we have live tunnels with to status of our own peer in hub.
+func (ict *InterClusterTunnelController) advertiseReachablePeers(ctx context.Context, live []string) {
+	self, err := ict.peerLister.Peers(ict.spec.ShareNamespace).Get(ict.spec.ClusterID)
+	if err != nil {
+		klog.V(5).Infof("can't get peer %s to advertise reachable peers: %v", ict.spec.ClusterID, err)
+		return
+	}
+	if len(self.Status.ReachablePeers) == 0 && len(live) == 0 ||
+		equality.Semantic.DeepEqual(self.Status.ReachablePeers, live) {
+		return
+	}
+	peer := self.DeepCopy()
+	peer.Status.ReachablePeers = live
+	if _, err = ict.fleetboardClient.FleetboardV1alpha1().Peers(peer.Namespace).
+		UpdateStatus(ctx, peer, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("advertise reachable peers of %s failed: %v", peer.Name, err)
+	}
+}
+
+// computeRelayRoutes walks the peer graph breadth first from localID, every cluster not reachable directly is
+// routed through the first hop on its shortest path. Result is keyed by the first hop, hubs never relay.
+func computeRelayRoutes(localID string, live []string, peers []*v1alpha1app.Peer) map[string][]string {
+	clusters := make(map[string]*v1alpha1app.Peer, len(peers))
+	for _, peer := range peers {
+		if !peer.Spec.IsHub {
+			clusters[peer.Spec.ClusterID] = peer
+		}
+	}
+	neighbors := func(id string) []string {
+		if id == localID {
+			return live
+		}
+		next := append([]string{}, clusters[id].Status.ReachablePeers...)
+		sort.Strings(next)
+		return next
+	}
+
+	firstHop := map[string]string{localID: ""}
+	queue := []string{localID}
+	for len(queue) != 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range neighbors(current) {
+			if _, visited := firstHop[next]; visited {
+				continue
+			}
+			if _, found := clusters[next]; !found {
+				continue
+			}
+			if current == localID {
+				firstHop[next] = next
+			} else {
+				firstHop[next] = firstHop[current]
+			}
+			queue = append(queue, next)
+		}
+	}
+
+	relays := make(map[string][]string)
+	for id, hop := range firstHop {
+		if id == localID || id == hop {
+			continue
+		}
+		relays[hop] = append(relays[hop], clusters[id].Spec.PodCIDR...)
+	}
+	for hop := range relays {
+		sort.Strings(relays[hop])
+	}
+	return relays
+}
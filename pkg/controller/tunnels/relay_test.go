@@ -0,0 +1,112 @@
+package tunnels
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+func Test_computeRelayRoutes(t *testing.T) {
+	newPeer := func(id, cidr string, isHub bool, reachable ...string) *v1alpha1app.Peer {
+		return &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: id, PodCIDR: []string{cidr}, IsHub: isHub},
+			Status: v1alpha1app.PeerStatus{ReachablePeers: reachable}}
+	}
+	tests := []struct {
+		name  string
+		live  []string
+		peers []*v1alpha1app.Peer
+		want  map[string][]string
+	}{
+		{
+			name: "all direct",
+			live: []string{"a", "b"},
+			peers: []*v1alpha1app.Peer{
+				newPeer("local", "10.0.0.0/24", false, "a", "b"),
+				newPeer("a", "10.0.1.0/24", false, "local", "b"),
+				newPeer("b", "10.0.2.0/24", false, "local", "a"),
+			},
+			want: map[string][]string{},
+		},
+		{
+			name: "multi hop through first relay",
+			live: []string{"a"},
+			peers: []*v1alpha1app.Peer{
+				newPeer("a", "10.0.1.0/24", false, "local", "b"),
+				newPeer("b", "10.0.2.0/24", false, "a", "c"),
+				newPeer("c", "10.0.3.0/24", false, "b"),
+			},
+			want: map[string][]string{"a": {"10.0.2.0/24", "10.0.3.0/24"}},
+		},
+		{
+			name: "hub never relays",
+			live: []string{},
+			peers: []*v1alpha1app.Peer{
+				newPeer("hub", "20.112.0.0/12", true, "a"),
+				newPeer("a", "10.0.1.0/24", false, "hub"),
+			},
+			want: map[string][]string{},
+		},
+		{
+			name: "unreachable cluster has no route",
+			live: []string{"a"},
+			peers: []*v1alpha1app.Peer{
+				newPeer("a", "10.0.1.0/24", false, "local"),
+				newPeer("b", "10.0.2.0/24", false),
+			},
+			want: map[string][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeRelayRoutes("local", tt.live, tt.peers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("computeRelayRoutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_staleRelayRoutes(t *testing.T) {
+	connected := map[string]*v1alpha1app.Peer{
+		"b": {Spec: v1alpha1app.PeerSpec{ClusterID: "b", PodCIDR: []string{"10.0.2.0/24"}}},
+	}
+	tests := []struct {
+		name     string
+		previous []string
+		routed   []string
+		want     []string
+	}{
+		{
+			name:     "still relayed",
+			previous: []string{"10.0.1.0/24"},
+			routed:   []string{"10.0.1.0/24"},
+			want:     []string{},
+		},
+		{
+			name:     "relayed cluster left",
+			previous: []string{"10.0.1.0/24", "10.0.3.0/24"},
+			routed:   []string{"10.0.3.0/24"},
+			want:     []string{"10.0.1.0/24"},
+		},
+		{
+			name:     "hub is back",
+			previous: []string{"10.0.1.0/24", "10.0.3.0/24"},
+			want:     []string{"10.0.1.0/24", "10.0.3.0/24"},
+		},
+		{
+			name:     "relayed cluster connected directly",
+			previous: []string{"10.0.1.0/24", "10.0.2.0/24"},
+			want:     []string{"10.0.1.0/24"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := staleRelayRoutes(sets.New(tt.previous...), sets.New(tt.routed...), connected)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("staleRelayRoutes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package tunnels
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+// peerRouter is the topology of inter cluster peers, sync loops of the controller change it and the tunnel
+// driver asks it whenever it configures a peer.
+type peerRouter struct {
+	sync.Mutex
+	spec           *tunnel.Specification
+	activeHub      string                   // clusterID of the hub owning the global cidr
+	directPeers    map[string]string        // clusterID -> punched endpoint confirmed by a handshake
+	relayedCIDRs   map[string][]string      // relay clusterID -> cidrs of other clusters behind it
+	activeGateways map[string]string        // clusterID -> public key of the gateway owning its cidrs
+	fallbacks      map[string]*fallbackPath // clusterID -> fallback transport in use
+}
+
+// fallbackPath is a fallback transport dialed at address.
+type fallbackPath struct {
+	client  *tunnel.FallbackClient
+	address string
+}
+
+func newPeerRouter(spec *tunnel.Specification) *peerRouter {
+	return &peerRouter{
+		spec:           spec,
+		directPeers:    make(map[string]string),
+		relayedCIDRs:   make(map[string][]string),
+		activeGateways: make(map[string]string),
+		fallbacks:      make(map[string]*fallbackPath),
+	}
+}
+
+// AllowedIPs routes cidrs of peer to its active gateway, and cidrs relayed through it on top. Standby hubs,
+// standby gateways and hole punched peers without a direct path stay connected without allowed ips.
+func (r *peerRouter) AllowedIPs(peer *v1alpha1app.Peer, publicKey string) []string {
+	r.Lock()
+	defer r.Unlock()
+	id := peer.Spec.ClusterID
+	if publicKey != r.activeGatewayKey(peer) {
+		return nil
+	}
+	if peer.Spec.IsHub && r.activeHub != id {
+		return nil
+	}
+	if endpoint, direct := r.directPeers[id]; tunnel.HolePunchingPeer(r.spec, peer) &&
+		(!direct || endpoint != peer.Status.ObservedEndpoint) {
+		// stay on hub path until a handshake proves the hole at current endpoint is punched.
+		return nil
+	}
+	return append(append([]string{}, peer.Spec.PodCIDR...), r.relayedCIDRs[id]...)
+}
+
+// Endpoint is the loopback end of the fallback transport of peer if it's in use.
+func (r *peerRouter) Endpoint(peer *v1alpha1app.Peer) *net.UDPAddr {
+	r.Lock()
+	defer r.Unlock()
+	if path, found := r.fallbacks[peer.Spec.ClusterID]; found && path.address == fallbackAddress(peer) {
+		return path.client.LocalAddr()
+	}
+	return nil
+}
+
+// activeGatewayKey falls back to the gateway in peer spec, caller must hold the lock.
+func (r *peerRouter) activeGatewayKey(peer *v1alpha1app.Peer) string {
+	if key, found := r.activeGateways[peer.Spec.ClusterID]; found {
+		for _, gateway := range peer.Spec.Gateways {
+			if gateway.PublicKey == key {
+				return key
+			}
+		}
+	}
+	return peer.Spec.PublicKey
+}
+
+func (r *peerRouter) activeGateway(peer *v1alpha1app.Peer) string {
+	r.Lock()
+	defer r.Unlock()
+	return r.activeGatewayKey(peer)
+}
+
+// setActiveGateway returns the previous one, and if it has changed.
+func (r *peerRouter) setActiveGateway(peer *v1alpha1app.Peer, publicKey string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	previous := r.activeGatewayKey(peer)
+	r.activeGateways[peer.Spec.ClusterID] = publicKey
+	return previous, previous != publicKey
+}
+
+func (r *peerRouter) hub() string {
+	r.Lock()
+	defer r.Unlock()
+	return r.activeHub
+}
+
+// adoptHub makes the first hub connected the active one.
+func (r *peerRouter) adoptHub(peer *v1alpha1app.Peer) {
+	r.Lock()
+	defer r.Unlock()
+	if peer.Spec.IsHub && len(r.activeHub) == 0 {
+		r.activeHub = peer.Spec.ClusterID
+	}
+}
+
+// setActiveHub returns the previous one, and if it has changed.
+func (r *peerRouter) setActiveHub(clusterID string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	previous := r.activeHub
+	r.activeHub = clusterID
+	return previous, previous != clusterID
+}
+
+// setDirectPath returns the previous punched endpoint, and if it has changed. An empty endpoint means hub path.
+func (r *peerRouter) setDirectPath(clusterID, endpoint string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	previous := r.directPeers[clusterID]
+	if len(endpoint) == 0 {
+		delete(r.directPeers, clusterID)
+	} else {
+		r.directPeers[clusterID] = endpoint
+	}
+	return previous, previous != endpoint
+}
+
+// setRelayedCIDRs returns the previous relays, and if they have changed.
+func (r *peerRouter) setRelayedCIDRs(relays map[string][]string) (map[string][]string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	if relays == nil {
+		relays = make(map[string][]string)
+	}
+	previous := r.relayedCIDRs
+	r.relayedCIDRs = relays
+	return previous, !reflect.DeepEqual(previous, relays)
+}
+
+func (r *peerRouter) fallback(clusterID string) *fallbackPath {
+	r.Lock()
+	defer r.Unlock()
+	return r.fallbacks[clusterID]
+}
+
+// setFallback returns the previous fallback path, nil path means udp.
+func (r *peerRouter) setFallback(clusterID string, path *fallbackPath) *fallbackPath {
+	r.Lock()
+	defer r.Unlock()
+	previous := r.fallbacks[clusterID]
+	if path == nil {
+		delete(r.fallbacks, clusterID)
+	} else {
+		r.fallbacks[clusterID] = path
+	}
+	return previous
+}
+
+// disconnect forgets the topology of a peer which is gone.
+func (r *peerRouter) disconnect(clusterID string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.directPeers, clusterID)
+	delete(r.relayedCIDRs, clusterID)
+	delete(r.activeGateways, clusterID)
+	if path, found := r.fallbacks[clusterID]; found {
+		_ = path.client.Close()
+		delete(r.fallbacks, clusterID)
+	}
+	if r.activeHub == clusterID {
+		r.activeHub = ""
+	}
+}
+
+// close closes all the fallback transports.
+func (r *peerRouter) close() {
+	r.Lock()
+	defer r.Unlock()
+	for clusterID, path := range r.fallbacks {
+		_ = path.client.Close()
+		delete(r.fallbacks, clusterID)
+	}
+}
+
+// fallbackAddress is where the fallback transport of peer is served.
+func fallbackAddress(peer *v1alpha1app.Peer) string {
+	return net.JoinHostPort(peer.Spec.Endpoint, strconv.Itoa(peer.Spec.FallbackPort))
+}
@@ -0,0 +1,109 @@
+package tunnels
+
+import (
+	"reflect"
+	"testing"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+func Test_peerRouterAllowedIPs(t *testing.T) {
+	hub := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "hub-2", PublicKey: "key-hub",
+		PodCIDR: []string{"20.112.0.0/12"}, IsHub: true}}
+	gateways := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "cluster-2", PublicKey: "key-a",
+		Endpoint: "2.2.2.2", PodCIDR: []string{"20.113.0.0/16"},
+		Gateways: []v1alpha1app.GatewaySpec{{Name: "node-b", PublicKey: "key-b"}}}}
+	punched := &v1alpha1app.Peer{
+		Spec:   v1alpha1app.PeerSpec{ClusterID: "cluster-3", PublicKey: "key-p", PodCIDR: []string{"20.114.0.0/16"}},
+		Status: v1alpha1app.PeerStatus{ObservedEndpoint: "3.3.3.3:41234"},
+	}
+	tests := []struct {
+		name   string
+		change func(r *peerRouter)
+		peer   *v1alpha1app.Peer
+		key    string
+		want   []string
+	}{
+		{
+			name:   "active hub",
+			change: func(r *peerRouter) { r.adoptHub(hub) },
+			peer:   hub,
+			key:    "key-hub",
+			want:   []string{"20.112.0.0/12"},
+		},
+		{
+			name:   "standby hub",
+			change: func(r *peerRouter) { r.setActiveHub("hub-1") },
+			peer:   hub,
+			key:    "key-hub",
+		},
+		{
+			name:   "gateway in peer spec by default",
+			change: func(_ *peerRouter) {},
+			peer:   gateways,
+			key:    "key-a",
+			want:   []string{"20.113.0.0/16"},
+		},
+		{
+			name:   "standby gateway",
+			change: func(r *peerRouter) { r.setActiveGateway(gateways, "key-b") },
+			peer:   gateways,
+			key:    "key-a",
+		},
+		{
+			name: "relayed cidrs on top",
+			change: func(r *peerRouter) {
+				r.setRelayedCIDRs(map[string][]string{"cluster-2": {"20.115.0.0/16"}})
+			},
+			peer: gateways,
+			key:  "key-a",
+			want: []string{"20.113.0.0/16", "20.115.0.0/16"},
+		},
+		{
+			name:   "hole punched peer on hub path",
+			change: func(_ *peerRouter) {},
+			peer:   punched,
+			key:    "key-p",
+		},
+		{
+			name:   "hole punched peer on direct path",
+			change: func(r *peerRouter) { r.setDirectPath("cluster-3", "3.3.3.3:41234") },
+			peer:   punched,
+			key:    "key-p",
+			want:   []string{"20.114.0.0/16"},
+		},
+		{
+			name:   "hole punched peer not observed yet",
+			change: func(_ *peerRouter) {},
+			peer:   &v1alpha1app.Peer{Spec: punched.Spec},
+			key:    "key-p",
+		},
+		{
+			name:   "direct path punched at another endpoint",
+			change: func(r *peerRouter) { r.setDirectPath("cluster-3", "3.3.3.3:50000") },
+			peer:   punched,
+			key:    "key-p",
+		},
+		{
+			name: "peer gone",
+			change: func(r *peerRouter) {
+				r.setActiveGateway(gateways, "key-b")
+				r.disconnect("cluster-2")
+			},
+			peer: gateways,
+			key:  "key-a",
+			want: []string{"20.113.0.0/16"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newPeerRouter(&tunnel.Specification{Options: tunnel.Options{EnableHolePunching: true}})
+			tt.change(r)
+			if got := r.AllowedIPs(tt.peer, tt.key); !reflect.DeepEqual(got, tt.want) &&
+				(len(got) != 0 || len(tt.want) != 0) {
+				t.Errorf("AllowedIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package tunnels
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+// topology returns how clusters connect with each other, empty if no cluster set sets it. Child clusters connecting
+// directly in hub-and-spoke come along.
+func (ict *InterClusterTunnelController) topology() (v1alpha1app.Topology, sets.Set[string]) {
+	clusterSet, err := ict.clusterSetLister.ClusterSets(ict.spec.ShareNamespace).Get(known.ClusterSetName)
+	if err != nil {
+		return "", sets.New[string]()
+	}
+	return clusterSet.Spec.Topology, sets.New(clusterSet.Spec.DirectClusters...)
+}
+
+// shouldConnect tells if this cluster builds a tunnel with peer under current topology.
+func (ict *InterClusterTunnelController) shouldConnect(peer *v1alpha1app.Peer) bool {
+	spec := ict.spec
+	topology, directClusters := ict.topology()
+	if len(topology) == 0 {
+		return ict.shouldConnectByDefault(peer)
+	}
+	// hubs don't connect with each other, every child cluster connects with all the hubs, public ones included,
+	// so that hub path is always there when a direct one is not.
+	if peer.Spec.IsHub || spec.AsHub {
+		return peer.Spec.IsHub != spec.AsHub
+	}
+	if ict.direct(peer, topology, directClusters) {
+		return true
+	}
+	// child clusters without endpoint may punch through nat when it's enabled.
+	return tunnel.HolePunchingPeer(spec, peer)
+}
+
+// shouldConnectByDefault is how clusters connect unless a cluster set picks a topology: child clusters dial
+// public child clusters directly and hub leaves those alone, private child clusters reach each other through hub.
+func (ict *InterClusterTunnelController) shouldConnectByDefault(peer *v1alpha1app.Peer) bool {
+	spec := ict.spec
+	// hubs don't connect with each other.
+	if peer.Spec.IsHub || (len(peer.Spec.Endpoint) != 0 && peer.Spec.IsPublic) {
+		return !spec.AsHub
+	}
+	// private child cluster, public child clusters let it dial in, or it may punch through nat.
+	return spec.AsHub || len(ict.publishedAt().endpoint) != 0 || tunnel.HolePunchingPeer(spec, peer)
+}
+
+// direct tells if child cluster peer and we build a tunnel between us: one of us has an endpoint the other dials,
+// and topology is full-mesh or both of us are direct clusters of hub-and-spoke.
+func (ict *InterClusterTunnelController) direct(peer *v1alpha1app.Peer, topology v1alpha1app.Topology,
+	directClusters sets.Set[string]) bool {
+	if len(peer.Spec.Endpoint) == 0 && len(ict.publishedAt().endpoint) == 0 {
+		return false
+	}
+	if topology == v1alpha1app.TopologyFullMesh {
+		return true
+	}
+	return directClusters.Has(ict.spec.ClusterID) && directClusters.Has(peer.Spec.ClusterID)
+}
+
+// enqueueAllPeers re-evaluates every peer, tunnels are built or recycled when topology changes.
+func (ict *InterClusterTunnelController) enqueueAllPeers() {
+	peers, err := ict.peerLister.Peers(ict.spec.ShareNamespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("can't list peers: %v", err)
+		return
+	}
+	topology, directClusters := ict.topology()
+	klog.Infof("topology is %q with direct clusters %v, re-evaluating %d peers", topology,
+		sets.List(directClusters), len(peers))
+	for _, peer := range peers {
+		ict.yachtController.Enqueue(peer)
+	}
+}
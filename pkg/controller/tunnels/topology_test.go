@@ -0,0 +1,125 @@
+package tunnels
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	v1alpha1app "github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/generated/listers/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/pkg/tunnel"
+)
+
+func Test_shouldConnect(t *testing.T) {
+	hub := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "hub", IsHub: true, Endpoint: "1.1.1.1"}}
+	public := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "public", Endpoint: "2.2.2.2", IsPublic: true}}
+	private := &v1alpha1app.Peer{Spec: v1alpha1app.PeerSpec{ClusterID: "private"}}
+	tests := []struct {
+		name       string
+		topology   v1alpha1app.Topology
+		direct     []string
+		asHub      bool
+		endpoint   string
+		holePunch  bool
+		peer       *v1alpha1app.Peer
+		want       bool
+		noClusters bool
+	}{
+		{name: "child connects with hub", peer: hub, want: true},
+		{name: "no cluster set dials public child", noClusters: true, peer: public, want: true},
+		{name: "no topology dials public child", peer: public, want: true},
+		{name: "no topology leaves public child alone in hub", asHub: true, peer: public},
+		{name: "no topology connects hub with private child", asHub: true, peer: private, want: true},
+		{name: "no topology lets private child dial in", endpoint: "3.3.3.3", peer: private, want: true},
+		{name: "no topology leaves private children to hub", peer: private},
+		{name: "no topology hubs don't connect", asHub: true, endpoint: "3.3.3.3", peer: hub},
+		{
+			name:     "hub-and-spoke connects hub with public child",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			asHub:    true,
+			peer:     public,
+			want:     true,
+		},
+		{
+			name:     "hub-and-spoke connects hub with private child",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			asHub:    true,
+			peer:     private,
+			want:     true,
+		},
+		{
+			name:     "hubs don't connect",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			asHub:    true,
+			endpoint: "3.3.3.3",
+			peer:     hub,
+		},
+		{name: "hub-and-spoke leaves public child to hub", topology: v1alpha1app.TopologyHubAndSpoke, peer: public},
+		{
+			name:     "hub-and-spoke leaves private child to hub",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			endpoint: "3.3.3.3",
+			peer:     private,
+		},
+		{
+			name:     "direct clusters in hub-and-spoke",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			direct:   []string{"local", "public"},
+			peer:     public,
+			want:     true,
+		},
+		{
+			name:     "direct clusters on one side only",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			direct:   []string{"public"},
+			peer:     public,
+		},
+		{
+			name:     "direct clusters without endpoint",
+			topology: v1alpha1app.TopologyHubAndSpoke,
+			direct:   []string{"local", "private"},
+			peer:     private,
+		},
+		{
+			name:      "hole punching in hub-and-spoke",
+			topology:  v1alpha1app.TopologyHubAndSpoke,
+			holePunch: true,
+			peer:      private,
+			want:      true,
+		},
+		{name: "full-mesh dials public child", topology: v1alpha1app.TopologyFullMesh, peer: public, want: true},
+		{
+			name:     "full-mesh lets private child dial in",
+			topology: v1alpha1app.TopologyFullMesh,
+			endpoint: "3.3.3.3",
+			peer:     private,
+			want:     true,
+		},
+		{name: "full-mesh without endpoints", topology: v1alpha1app.TopologyFullMesh, peer: private},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if !tt.noClusters {
+				_ = indexer.Add(&v1alpha1app.ClusterSet{
+					ObjectMeta: metav1.ObjectMeta{Name: known.ClusterSetName, Namespace: "share"},
+					Spec:       v1alpha1app.ClusterSetSpec{Topology: tt.topology, DirectClusters: tt.direct},
+				})
+			}
+			ict := &InterClusterTunnelController{
+				clusterSetLister: v1alpha1.NewClusterSetLister(indexer),
+				published:        publishedAddress{endpoint: tt.endpoint},
+				spec: &tunnel.Specification{
+					Options: tunnel.Options{ShareNamespace: "share", AsHub: tt.asHub,
+						EnableHolePunching: tt.holePunch},
+					EnvConfig: known.EnvConfig{ClusterID: "local", Endpoint: tt.endpoint},
+				},
+			}
+			if got := ict.shouldConnect(tt.peer); got != tt.want {
+				t.Errorf("shouldConnect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package dedinic
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vishvananda/netlink"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+// ipamDataDir is where host-local keeps ips of dedicated nics, named after the network in cniConf.
+const ipamDataDir = "/var/lib/cni/networks/dedicate-cni"
+
+// Cleanup removes the fleetboard bridge and dedicated nics attached to it, their peers in pods go along with
+// routes through them, then releases all ips allocated to them.
+func Cleanup() error {
+	var errs []error
+	bridge, err := netlink.LinkByName(CNFBridgeName)
+	if err == nil {
+		errs = append(errs, deleteBridgePorts(bridge)...)
+		if err = netlink.LinkDel(bridge); err != nil {
+			errs = append(errs, fmt.Errorf("delete bridge %s failed: %v", CNFBridgeName, err))
+		}
+	} else if _, notFound := err.(netlink.LinkNotFoundError); !notFound {
+		errs = append(errs, fmt.Errorf("could not find bridge %s: %v", CNFBridgeName, err))
+	}
+
+	if err = os.RemoveAll(ipamDataDir); err != nil {
+		errs = append(errs, fmt.Errorf("release dedicated nic ips failed: %v", err))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func deleteBridgePorts(bridge netlink.Link) []error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return []error{fmt.Errorf("failed to list links: %v", err)}
+	}
+	var errs []error
+	for _, link := range links {
+		if link.Attrs().MasterIndex != bridge.Attrs().Index {
+			continue
+		}
+		klog.Infof("delete dedicated nic %s", link.Attrs().Name)
+		if err = netlink.LinkDel(link); err != nil {
+			errs = append(errs, fmt.Errorf("delete nic %s failed: %v", link.Attrs().Name, err))
+		}
+	}
+	return errs
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
@@ -12,6 +13,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/fleetboard-io/fleetboard/pkg/cnf/metrics"
 	"github.com/fleetboard-io/fleetboard/pkg/known"
 )
 
@@ -51,13 +53,14 @@ func (ch cniHandler) handleAdd(rq *CniRequest) error {
 	}
 	klog.Infof("add port request: %v", rq)
 	var err error
+	defer observeNRIOperation(nriAdd, time.Now(), &err)
 
 	ip, err := GetIP(rq, ch.cniConfStr)
 	if err != nil {
 		klog.Errorf("get ip failed: %v", err)
-	} else {
-		klog.Infof("pod ip info: %v", ip)
+		return err
 	}
+	klog.Infof("pod ip info: %v", ip)
 
 	ipStr := ip.IPs[0].Address.String()
 	routes := []Route{
@@ -69,18 +72,34 @@ func (ch cniHandler) handleAdd(rq *CniRequest) error {
 			Destination: ServiceCIDR,
 			Gateway:     CNFBridgeIP,
 		}}
-	err = ch.configureNic(rq.NetNs, rq.ContainerID, rq.IfName, ipStr, routes)
-	if err != nil {
-		klog.Errorf("add nic failed: %v", err)
+	errNic := ch.configureNic(rq.NetNs, rq.ContainerID, rq.IfName, ipStr, routes)
+	if errNic != nil {
+		klog.Errorf("add nic failed: %v", errNic)
 	}
 	// add IP to the pod annotation
 	if err = ch.updateTheIPToPod(rq.PodName, rq.PodNamespace, strings.Split(ipStr, "/")[0]); err != nil {
 		klog.Errorf("update annotaion failed: %v/%v", rq.PodNamespace, rq.PodName)
 	}
-
+	if errNic != nil {
+		err = errNic
+	}
 	return err
 }
 
+// nri operations
+const (
+	nriAdd    = "add"
+	nriDelete = "delete"
+)
+
+// observeNRIOperation records latency of the operation started at start, and a failure if *err is set.
+func observeNRIOperation(operation string, start time.Time, err *error) {
+	metrics.NRIOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		metrics.NRIOperationFailures.WithLabelValues(operation).Inc()
+	}
+}
+
 func isCNFSelf(podNamespace, podName string) bool {
 	if (podName == CNFPodName && podNamespace == CNFPodNamespace) ||
 		(podNamespace == CNFPodNamespace && strings.Contains(podName, "cnf")) {
@@ -116,7 +135,7 @@ func (ch cniHandler) configureNic(netns, containerID,
 	return configureContainerNic(containerNicName, ifName, ip, routes, podNS)
 }
 
-func (ch cniHandler) handleDel(rq *CniRequest) error {
+func (ch cniHandler) handleDel(rq *CniRequest) (err error) {
 	klog.V(6).Infof("del nic for pod: %v/%v", rq.PodNamespace, rq.PodName)
 	if isCNFSelf(rq.PodNamespace, rq.PodName) {
 		br, err := netlink.LinkByName(CNFBridgeName)
@@ -131,7 +150,8 @@ func (ch cniHandler) handleDel(rq *CniRequest) error {
 		return nil
 	}
 
-	err := DelIP(rq, ch.cniConfStr)
+	defer observeNRIOperation(nriDelete, time.Now(), &err)
+	err = DelIP(rq, ch.cniConfStr)
 	if err != nil {
 		klog.Errorf("del nic failed: %v", err)
 		return err
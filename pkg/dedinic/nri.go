@@ -3,7 +3,7 @@ package dedinic
 import (
 	"context"
 	"fmt"
-	"os"
+	"sync/atomic"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
@@ -36,9 +36,18 @@ type CNIPlugin struct {
 var (
 	csh *cniHandler
 	_   = stub.ConfigureInterface(&CNIPlugin{})
+
+	// nriConnected is set once runtime configures the plugin.
+	nriConnected atomic.Bool
 )
 
-func InitNRIPlugin(kubeClient *kubernetes.Clientset) {
+// NRIConnected tells if the plugin is registered with the container runtime.
+func NRIConnected() bool {
+	return nriConnected.Load()
+}
+
+// InitNRIPlugin runs the plugin until ctx is done or its connection with the container runtime is gone.
+func InitNRIPlugin(ctx context.Context, kubeClient *kubernetes.Clientset) error {
 	var (
 		err  error
 		opts []stub.Option
@@ -56,24 +65,30 @@ func InitNRIPlugin(kubeClient *kubernetes.Clientset) {
 	klog.Info("nri start ....")
 
 	if p.Mask, err = api.ParseEventMask(events); err != nil {
-		klog.Errorf("nri failed to parse events: %v", err)
+		return fmt.Errorf("nri failed to parse events: %v", err)
 	}
 
 	if p.Stub, err = stub.New(p, append(opts, stub.WithOnClose(p.OnClose))...); err != nil {
-		klog.Errorf("nri failed to create nri stub: %v", err)
+		return fmt.Errorf("nri failed to create nri stub: %v", err)
 	}
 
 	csh = createCniHandler(kubeClient)
 	klog.Info(">>>>>>>>>>>>>>>>>>>>>  nri CNI Plugin Started - Version Tag 0.0.1 <<<<<<<<<<<<<<<<<<<<<<<<<<")
 
-	err = p.Stub.Run(context.Background())
+	err = p.Stub.Run(ctx)
+	nriConnected.Store(false)
 	if err != nil {
-		klog.Errorf("nri CNIPlugin exited with error %v", err)
+		return fmt.Errorf("nri CNIPlugin exited with error %v", err)
 	}
+	if ctx.Err() == nil {
+		return fmt.Errorf("nri CNIPlugin lost the container runtime")
+	}
+	return nil
 }
 
 func (p *CNIPlugin) Configure(config, runtime, version string) (stub.EventMask, error) {
 	klog.Infof("got configuration data: %q from runtime %s %s", config, runtime, version)
+	nriConnected.Store(true)
 
 	return p.Mask, nil
 }
@@ -166,9 +181,9 @@ func (p *CNIPlugin) RemovePodSandbox(pod *api.PodSandbox) error {
 	return nil
 }
 
+// OnClose is called once the container runtime is gone, InitNRIPlugin returns then and the plugin is started again.
 func (p *CNIPlugin) OnClose() {
 	klog.Errorf("cni plugin closed")
-	os.Exit(0)
 }
 
 func GetNSPathFromPod(pod *api.PodSandbox) (nsPath string, err error) {
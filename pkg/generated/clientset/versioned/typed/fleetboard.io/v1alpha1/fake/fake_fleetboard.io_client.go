@@ -27,6 +27,10 @@ type FakeFleetboardV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeFleetboardV1alpha1) ClusterSets(namespace string) v1alpha1.ClusterSetInterface {
+	return &FakeClusterSets{c, namespace}
+}
+
 func (c *FakeFleetboardV1alpha1) Peers(namespace string) v1alpha1.PeerInterface {
 	return &FakePeers{c, namespace}
 }
@@ -101,6 +101,18 @@ func (c *FakePeers) Update(ctx context.Context, peer *v1alpha1.Peer, opts v1.Upd
 	return obj.(*v1alpha1.Peer), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakePeers) UpdateStatus(ctx context.Context, peer *v1alpha1.Peer, opts v1.UpdateOptions) (*v1alpha1.Peer, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(peersResource, "status", c.ns, peer), &v1alpha1.Peer{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.Peer), err
+}
+
 // Delete takes name of the peer and deletes it. Returns an error if one occurs.
 func (c *FakePeers) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	_, err := c.Fake.
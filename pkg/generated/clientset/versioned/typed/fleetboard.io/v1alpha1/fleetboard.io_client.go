@@ -25,6 +25,7 @@ import (
 
 type FleetboardV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	ClusterSetsGetter
 	PeersGetter
 }
 
@@ -33,6 +34,10 @@ type FleetboardV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *FleetboardV1alpha1Client) ClusterSets(namespace string) ClusterSetInterface {
+	return newClusterSets(c, namespace)
+}
+
 func (c *FleetboardV1alpha1Client) Peers(namespace string) PeerInterface {
 	return newPeers(c, namespace)
 }
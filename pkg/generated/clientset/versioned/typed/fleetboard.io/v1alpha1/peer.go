@@ -39,6 +39,7 @@ type PeersGetter interface {
 type PeerInterface interface {
 	Create(ctx context.Context, peer *v1alpha1.Peer, opts v1.CreateOptions) (*v1alpha1.Peer, error)
 	Update(ctx context.Context, peer *v1alpha1.Peer, opts v1.UpdateOptions) (*v1alpha1.Peer, error)
+	UpdateStatus(ctx context.Context, peer *v1alpha1.Peer, opts v1.UpdateOptions) (*v1alpha1.Peer, error)
 	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
 	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.Peer, error)
@@ -134,6 +135,22 @@ func (c *peers) Update(ctx context.Context, peer *v1alpha1.Peer, opts v1.UpdateO
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *peers) UpdateStatus(ctx context.Context, peer *v1alpha1.Peer, opts v1.UpdateOptions) (result *v1alpha1.Peer, err error) {
+	result = &v1alpha1.Peer{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("peers").
+		Name(peer.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(peer).
+		Do(ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the peer and deletes it. Returns an error if one occurs.
 func (c *peers) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	return c.client.Delete().
@@ -23,6 +23,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// ClusterSets returns a ClusterSetInformer.
+	ClusterSets() ClusterSetInformer
 	// Peers returns a PeerInformer.
 	Peers() PeerInformer
 }
@@ -38,6 +40,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// ClusterSets returns a ClusterSetInformer.
+func (v *version) ClusterSets() ClusterSetInformer {
+	return &clusterSetInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // Peers returns a PeerInformer.
 func (v *version) Peers() PeerInformer {
 	return &peerInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
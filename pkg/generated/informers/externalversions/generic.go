@@ -52,6 +52,8 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=fleetboard.io, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("clustersets"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Fleetboard().V1alpha1().ClusterSets().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("peers"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Fleetboard().V1alpha1().Peers().Informer()}, nil
 
@@ -17,6 +17,14 @@ limitations under the License.
 
 package v1alpha1
 
+// ClusterSetListerExpansion allows custom methods to be added to
+// ClusterSetLister.
+type ClusterSetListerExpansion interface{}
+
+// ClusterSetNamespaceListerExpansion allows custom methods to be added to
+// ClusterSetNamespaceLister.
+type ClusterSetNamespaceListerExpansion interface{}
+
 // PeerListerExpansion allows custom methods to be added to
 // PeerLister.
 type PeerListerExpansion interface{}
@@ -8,6 +8,8 @@ const (
 	FleetboardNodeCIDR     = "fleetboard.io/node_cidr"
 	FleetboardServiceCIDR  = "fleetboard.io/service_cidr"
 
-	PublicKey            = "fleetboard.io/public_key"
+	PublicKey = "fleetboard.io/public_key"
+	// NextPublicKey is published ahead of a key rotation, empty when no rotation is in progress.
+	NextPublicKey        = "fleetboard.io/next_public_key"
 	FleetboardParallelIP = "router.fleetboard.io/parallel_ip"
 )
@@ -7,8 +7,11 @@ import (
 const (
 	Fleetboard                = "fleetboard"
 	FleetboardSystemNamespace = "fleetboard-system"
-	HubClusterName            = "hub"
 	HubSecretName             = Fleetboard
+	// ClusterSetName is the only cluster set object in the shared namespace of hub.
+	ClusterSetName = Fleetboard
+	// GatewayServiceName exposes wire-guard port of the cnf leader.
+	GatewayServiceName = "fleetboard-gateway"
 )
 
 // pod environment variables
@@ -39,3 +42,7 @@ const (
 
 	SectionStatus = "/status"
 )
+
+// CNFStartedCondition is the condition of cnf pod telling if its startup phases are done, reason of a false
+// condition is the failing phase.
+const CNFStartedCondition = "fleetboard.io/cnf-started"
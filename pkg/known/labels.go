@@ -11,6 +11,10 @@ const (
 	ObjectCreatedByLabel    = "fleetboard.io/created-by"
 	RouterCNFCreatedByLabel = "router.fleetboard.io/cnf=true"
 	LeaderCNFLabelKey       = "router.fleetboard.io/leader"
+	// GatewayCNFLabelKey marks cnf pods holding inter cluster tunnels along with the leader.
+	GatewayCNFLabelKey = "router.fleetboard.io/gateway"
+	// GatewayCandidateLabelKey marks cnf pods which may become gateways.
+	GatewayCandidateLabelKey = "router.fleetboard.io/gateway-candidate"
 )
 
 const (
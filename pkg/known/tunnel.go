@@ -12,9 +12,31 @@ const (
 	// DefaultDeviceName specifies name of WireGuard network device.
 	DefaultDeviceName = "wg0"
 	DediNIC           = "eth-fleet"
+	// IPIPDeviceName is used by inner cluster tunnels in ip-in-ip transport.
+	IPIPDeviceName = "ipip-fleet"
 
 	CNFBridgeName   = Fleetboard
 	CNIProviderName = Fleetboard
 
 	UDPPort = 31820
+	// FallbackPort serves wire-guard over tcp or websocket when udp is blocked.
+	FallbackPort = 31821
+
+	// WireguardKeySecretPrefix prefixes the per-node secret which keeps wire-guard keys across restarts.
+	WireguardKeySecretPrefix = "fleetboard-wireguard-"
+	WireguardPrivateKey      = "private_key"
+	// WireguardPreviousPrivateKey is kept during a key rotation, until remote peers pick up the new key.
+	WireguardPreviousPrivateKey = "previous_private_key"
+	// WireguardNextPrivateKey is kept from publishing the next key until the device switches to it.
+	WireguardNextPrivateKey = "next_private_key"
+	WireguardKeyRotatedAt   = "fleetboard.io/key_rotated_at"
+	WireguardKeyStagedAt    = "fleetboard.io/key_staged_at"
+
+	// PresharedKeySecretPrefix prefixes the secret shared by two cnf pods of a cluster, which keeps their pre-shared key.
+	PresharedKeySecretPrefix = "fleetboard-psk-"
+	WireguardPresharedKey    = "preshared_key"
+	PresharedKeyPair         = "fleetboard.io/psk_pair"
+	// PresharedKeyExchangeSecret keeps the key a cluster derives pre-shared keys with other clusters from.
+	PresharedKeyExchangeSecret = "fleetboard-psk-exchange"
+	WireguardExchangeKey       = "exchange_key"
 )
@@ -4,16 +4,22 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corelisterv1 "k8s.io/client-go/listers/core/v1"
 	discoverylisterv1 "k8s.io/client-go/listers/discovery/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 	alpha1 "sigs.k8s.io/mcs-api/pkg/client/listers/apis/v1alpha1"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/request"
 	"github.com/fleetboard-io/fleetboard/pkg/known"
@@ -29,12 +35,19 @@ type CrossDNS struct {
 	epsSynced            cache.InformerSynced
 	SILister             alpha1.ServiceImportLister
 	SISynced             cache.InformerSynced
+	// indexers of endpoint slices and service imports by ip, for reverse lookups.
+	epsIndexer   cache.Indexer
+	siIndexer    cache.Indexer
+	cnfPodLister corelisterv1.PodLister
+	cnfPodSynced cache.InformerSynced
 }
 
 type DNSRecord struct {
 	IP          string
 	HostName    string
 	ClusterName string
+	// Ports are ports of the endpoint, they are empty for a clusterset ip.
+	Ports []v1alpha1.ServicePort
 }
 
 func (c CrossDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
@@ -48,6 +61,9 @@ func (c CrossDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 	}
 
 	klog.Infof("Request received for %q", qname)
+	if state.QType() == dns.TypePTR && isReverseZone(zone) {
+		return c.serveReverse(ctx, state)
+	}
 	if state.QType() != dns.TypeA && state.QType() != dns.TypeAAAA && state.QType() != dns.TypeSRV {
 		msg := fmt.Sprintf("Query of type %d is not supported", state.QType())
 		klog.Info(msg)
@@ -67,7 +83,7 @@ func (c CrossDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 	return c.getDNSRecord(ctx, zone, state, w, r, pReq)
 }
 
-func (c *CrossDNS) getDNSRecord(ctx context.Context, _ string, state *request.Request, w dns.ResponseWriter,
+func (c *CrossDNS) getDNSRecord(ctx context.Context, zone string, state *request.Request, w dns.ResponseWriter,
 	r *dns.Msg, pReq *recordRequest,
 ) (int, error) {
 	// wait for endpoint slice synced.
@@ -85,11 +101,11 @@ func (c *CrossDNS) getDNSRecord(ctx context.Context, _ string, state *request.Re
 	var err error
 	var srcEndpointSliceList []*v1.EndpointSlice
 	if si.Spec.Type == v1alpha1.ClusterSetIP {
-		if len(si.Spec.IPs) != 0 {
-			record := DNSRecord{
-				IP: si.Spec.IPs[0],
+		// one ip per family with dual-stack, only headless services have records per pod.
+		if pReq.hostname == "" {
+			for _, ip := range si.Spec.IPs {
+				dnsRecords = append(dnsRecords, DNSRecord{IP: ip})
 			}
-			dnsRecords = append(dnsRecords, record)
 		}
 	} else {
 		if pReq.cluster != "" {
@@ -112,7 +128,7 @@ func (c *CrossDNS) getDNSRecord(ctx context.Context, _ string, state *request.Re
 			klog.Errorf("Failed to write message %v", err)
 			return dns.RcodeServerFailure, errors.New("failed to write response")
 		}
-		record := c.getAllRecordsFromEndpointslice(srcEndpointSliceList)
+		record := c.getAllRecordsFromEndpointslice(srcEndpointSliceList, pReq.hostname)
 		dnsRecords = append(dnsRecords, record...)
 	}
 	if len(dnsRecords) == 0 {
@@ -121,15 +137,24 @@ func (c *CrossDNS) getDNSRecord(ctx context.Context, _ string, state *request.Re
 	}
 
 	records := make([]dns.RR, 0)
+	extra := make([]dns.RR, 0)
 
-	if state.QType() == dns.TypeA {
-		records = c.createARecords(dnsRecords, state)
+	switch state.QType() {
+	case dns.TypeA, dns.TypeAAAA:
+		records = c.createAddressRecords(dnsRecords, state)
+	case dns.TypeSRV:
+		if si.Spec.Type == v1alpha1.ClusterSetIP {
+			records = c.createServiceSRVRecords(si, zone, state, pReq)
+		} else {
+			records, extra = c.createEndpointSRVRecords(dnsRecords, zone, state, pReq)
+		}
 	}
 
 	a := new(dns.Msg)
 	a.SetReply(r)
 	a.Authoritative = true
 	a.Answer = append(a.Answer, records...)
+	a.Extra = append(a.Extra, extra...)
 	klog.Infof("Responding to query with '%s'", a.Answer)
 
 	wErr := w.WriteMsg(a)
@@ -142,18 +167,51 @@ func (c *CrossDNS) getDNSRecord(ctx context.Context, _ string, state *request.Re
 	return dns.RcodeSuccess, nil
 }
 
-func (c CrossDNS) getAllRecordsFromEndpointslice(slices []*v1.EndpointSlice) []DNSRecord {
-	records := make([]DNSRecord, 0)
+// getAllRecordsFromEndpointslice returns a record per address of ready endpoints, or of terminating endpoints
+// still serving if none is ready. A non-empty hostname keeps the endpoint with it only, e.g. a pod of a stateful set.
+func (c CrossDNS) getAllRecordsFromEndpointslice(slices []*v1.EndpointSlice, hostname string) []DNSRecord {
+	ready := make([]DNSRecord, 0)
+	terminating := make([]DNSRecord, 0)
 	for _, eps := range slices {
+		if eps.AddressType == v1.AddressTypeFQDN {
+			continue
+		}
+		ports := servicePorts(eps.Ports)
 		for _, endpoint := range eps.Endpoints {
-			record := DNSRecord{
-				IP:          endpoint.Addresses[0],
-				ClusterName: eps.GetLabels()[known.LabelClusterID],
+			endpointHost := endpointHostname(endpoint)
+			if hostname != "" && !strings.EqualFold(endpointHost, hostname) {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				record := DNSRecord{
+					IP:          address,
+					HostName:    endpointHost,
+					ClusterName: eps.GetLabels()[known.LabelClusterID],
+					Ports:       ports,
+				}
+				if endpointReady(endpoint) {
+					ready = append(ready, record)
+				} else if endpointServingTerminating(endpoint) {
+					terminating = append(terminating, record)
+				}
 			}
-			records = append(records, record)
 		}
 	}
-	return records
+	if len(ready) != 0 {
+		return ready
+	}
+	return terminating
+}
+
+// endpointReady tells if the endpoint is ready, nil means unknown and is taken as ready.
+func endpointReady(endpoint v1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+// endpointServingTerminating tells if the endpoint is terminating but still serves, nil serving follows ready.
+func endpointServingTerminating(endpoint v1.Endpoint) bool {
+	serving := ptr.Deref(endpoint.Conditions.Serving, endpointReady(endpoint))
+	return serving && ptr.Deref(endpoint.Conditions.Terminating, false)
 }
 
 func (c CrossDNS) Name() string {
@@ -179,18 +237,148 @@ func writeResponse(state *request.Request, a *dns.Msg) (int, error) {
 	return dns.RcodeSuccess, nil
 }
 
-func (c CrossDNS) createARecords(dnsrecords []DNSRecord, state *request.Request) []dns.RR {
+// createAddressRecords creates A or AAAA records as queried, ips of the other family are left out.
+func (c CrossDNS) createAddressRecords(dnsrecords []DNSRecord, state *request.Request) []dns.RR {
 	records := make([]dns.RR, 0)
 
 	for _, record := range dnsrecords {
-		dnsRecord := &dns.A{Hdr: dns.RR_Header{
-			Name: state.QName(), Rrtype: dns.TypeA, Class: state.QClass(),
-			Ttl: uint32(5),
-		}, A: net.ParseIP(record.IP).To4()}
-		records = append(records, dnsRecord)
+		if dnsRecord := addressRecord(state.QName(), state.QType(), state.QClass(), record.IP); dnsRecord != nil {
+			records = append(records, dnsRecord)
+		}
+	}
+
+	return records
+}
+
+// addressRecord returns an A or AAAA record of name, nil if ip is not of the family of qType.
+func addressRecord(name string, qType, qClass uint16, ip string) dns.RR {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+	hdr := dns.RR_Header{Name: name, Rrtype: qType, Class: qClass, Ttl: defaultTTL}
+	if qType == dns.TypeA && parsed.To4() != nil {
+		return &dns.A{Hdr: hdr, A: parsed.To4()}
+	}
+	if qType == dns.TypeAAAA && parsed.To4() == nil {
+		return &dns.AAAA{Hdr: hdr, AAAA: parsed}
+	}
+	return nil
+}
+
+// srvTarget is where a SRV record points to.
+type srvTarget struct {
+	target string
+	port   int32
+}
+
+// createServiceSRVRecords creates SRV records of a clusterset ip service, they all target the service name.
+func (c CrossDNS) createServiceSRVRecords(si *v1alpha1.ServiceImport, zone string, state *request.Request,
+	pReq *recordRequest) []dns.RR {
+	target := dnsutil.Join(pReq.service, pReq.namespace, Svc, zone)
+	targets := make([]srvTarget, 0)
+	for _, port := range matchingPorts(si.Spec.Ports, pReq) {
+		targets = append(targets, srvTarget{target: target, port: port.Port})
+	}
+	return createSRVRecords(targets, state)
+}
+
+// createEndpointSRVRecords creates SRV records of a headless service targeting endpoint hostnames, addresses of
+// the targets go to the additional section.
+func (c CrossDNS) createEndpointSRVRecords(dnsrecords []DNSRecord, zone string, state *request.Request,
+	pReq *recordRequest) (records, extra []dns.RR) {
+	seen := make(map[srvTarget]bool)
+	targets := make([]srvTarget, 0)
+	extra = make([]dns.RR, 0)
+	for _, record := range dnsrecords {
+		ports := matchingPorts(record.Ports, pReq)
+		if len(ports) == 0 || len(record.HostName) == 0 {
+			continue
+		}
+		target := dnsutil.Join(record.HostName, record.ClusterName, pReq.service, pReq.namespace, Svc, zone)
+		for _, port := range ports {
+			key := srvTarget{target: target, port: port.Port}
+			if !seen[key] {
+				seen[key] = true
+				targets = append(targets, key)
+			}
+		}
+		for _, qType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			if dnsRecord := addressRecord(target, qType, state.QClass(), record.IP); dnsRecord != nil {
+				extra = append(extra, dnsRecord)
+			}
+		}
 	}
+	return createSRVRecords(targets, state), extra
+}
 
+// createSRVRecords creates SRV records of the same priority weighted evenly.
+func createSRVRecords(targets []srvTarget, state *request.Request) []dns.RR {
+	records := make([]dns.RR, 0, len(targets))
+	weight := uint16(100)
+	if len(targets) > 1 {
+		weight = uint16(max(100/len(targets), 1))
+	}
+	for _, target := range targets {
+		records = append(records, &dns.SRV{
+			Hdr: dns.RR_Header{
+				Name: state.QName(), Rrtype: dns.TypeSRV, Class: state.QClass(),
+				Ttl: defaultTTL,
+			},
+			Priority: 0,
+			Weight:   weight,
+			Port:     uint16(target.port),
+			Target:   target.target,
+		})
+	}
 	return records
 }
 
+// matchingPorts are ports matching port name and protocol of a SRV query, empty or "*" matches any.
+func matchingPorts(ports []v1alpha1.ServicePort, pReq *recordRequest) []v1alpha1.ServicePort {
+	matched := make([]v1alpha1.ServicePort, 0)
+	for _, port := range ports {
+		if matches(pReq.port, port.Name) && matches(pReq.protocol, string(port.Protocol)) {
+			matched = append(matched, port)
+		}
+	}
+	return matched
+}
+
+func matches(want, value string) bool {
+	return want == "" || want == "*" || strings.EqualFold(want, value)
+}
+
+// servicePorts converts ports of an endpoint slice, a port without number means all ports and is left out.
+func servicePorts(endpointPorts []v1.EndpointPort) []v1alpha1.ServicePort {
+	ports := make([]v1alpha1.ServicePort, 0, len(endpointPorts))
+	for _, endpointPort := range endpointPorts {
+		if endpointPort.Port == nil {
+			continue
+		}
+		port := v1alpha1.ServicePort{
+			Name:     ptr.Deref(endpointPort.Name, ""),
+			Protocol: ptr.Deref(endpointPort.Protocol, corev1.ProtocolTCP),
+			Port:     *endpointPort.Port,
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// endpointHostname is hostname of the endpoint, its pod name if it has none, or its ip with dashes at last.
+func endpointHostname(endpoint v1.Endpoint) string {
+	if endpoint.Hostname != nil && len(*endpoint.Hostname) != 0 {
+		return *endpoint.Hostname
+	}
+	if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" &&
+		len(validation.IsDNS1123Label(endpoint.TargetRef.Name)) == 0 {
+		return endpoint.TargetRef.Name
+	}
+	if len(endpoint.Addresses) != 0 {
+		return strings.NewReplacer(".", "-", ":", "-").Replace(endpoint.Addresses[0])
+	}
+	return ""
+}
+
 var _ plugin.Handler = &CrossDNS{}
@@ -0,0 +1,395 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisterv1 "k8s.io/client-go/listers/core/v1"
+	discoverylisterv1 "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+	alpha1 "sigs.k8s.io/mcs-api/pkg/client/listers/apis/v1alpha1"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/miekg/dns"
+)
+
+// responseWriter keeps the response written, other methods are not used.
+type responseWriter struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *responseWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+func newTestCrossDNS(objs ...interface{}) *CrossDNS {
+	epsIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc, ipIndex: endpointSliceIPIndexFunc})
+	siIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc, ipIndex: serviceImportIPIndexFunc})
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objs {
+		switch obj.(type) {
+		case *v1.EndpointSlice:
+			_ = epsIndexer.Add(obj)
+		case *v1alpha1.ServiceImport:
+			_ = siIndexer.Add(obj)
+		case *corev1.Pod:
+			_ = podIndexer.Add(obj)
+		}
+	}
+	synced := func() bool { return true }
+	return &CrossDNS{
+		Zones:                []string{"fleetboard.local.", "in-addr.arpa.", "ip6.arpa."},
+		endpointSlicesLister: discoverylisterv1.NewEndpointSliceLister(epsIndexer),
+		epsSynced:            synced,
+		SILister:             alpha1.NewServiceImportLister(siIndexer),
+		SISynced:             synced,
+		epsIndexer:           epsIndexer,
+		siIndexer:            siIndexer,
+		cnfPodLister:         corelisterv1.NewPodLister(podIndexer),
+		cnfPodSynced:         synced,
+	}
+}
+
+func serviceImport(name string, siType v1alpha1.ServiceImportType, ips ...string) *v1alpha1.ServiceImport {
+	return &v1alpha1.ServiceImport{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1alpha1.ServiceImportSpec{
+			Type: siType,
+			IPs:  ips,
+			Ports: []v1alpha1.ServicePort{
+				{Name: "grpc", Protocol: "TCP", Port: 9090},
+				{Name: "metrics", Protocol: "TCP", Port: 8080},
+			},
+		},
+	}
+}
+
+func endpointSlice(name, service, cluster string, addressType v1.AddressType,
+	endpoints ...v1.Endpoint) *v1.EndpointSlice {
+	return &v1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				known.LabelServiceName:      service,
+				known.LabelServiceNameSpace: "default",
+				known.LabelClusterID:        cluster,
+			},
+		},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+		Ports: []v1.EndpointPort{
+			{Name: ptr.To("grpc"), Protocol: ptr.To[corev1.Protocol]("TCP"), Port: ptr.To[int32](9090)},
+		},
+	}
+}
+
+// answers are rdata of records in section, sorted.
+func answers(section []dns.RR) []string {
+	values := make([]string, 0, len(section))
+	for _, rr := range section {
+		values = append(values, rr.String()[len(rr.Header().String()):])
+	}
+	sort.Strings(values)
+	return values
+}
+
+func query(t *testing.T, c *CrossDNS, qname string, qType uint16) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(qname, qType)
+	w := &responseWriter{}
+	if _, err := c.ServeDNS(context.Background(), w, r); err != nil {
+		t.Fatalf("ServeDNS(%s) failed: %v", qname, err)
+	}
+	if w.msg == nil {
+		t.Fatalf("ServeDNS(%s) wrote no response", qname)
+	}
+	return w.msg
+}
+
+func TestServeDNSAddressFamily(t *testing.T) {
+	c := newTestCrossDNS(
+		serviceImport("nginx", v1alpha1.ClusterSetIP, "10.96.0.10", "fd00::10"),
+		serviceImport("web", v1alpha1.Headless),
+		endpointSlice("web-v4", "web", "cluster-a", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.112.0.5"}}),
+		endpointSlice("web-v6", "web", "cluster-a", v1.AddressTypeIPv6,
+			v1.Endpoint{Addresses: []string{"fd11::5"}}),
+	)
+	tests := []struct {
+		name  string
+		qname string
+		qType uint16
+		want  []string
+	}{
+		{
+			name:  "clusterset ip A",
+			qname: "nginx.default.svc.fleetboard.local.",
+			qType: dns.TypeA,
+			want:  []string{"10.96.0.10"},
+		},
+		{
+			name:  "clusterset ip AAAA",
+			qname: "nginx.default.svc.fleetboard.local.",
+			qType: dns.TypeAAAA,
+			want:  []string{"fd00::10"},
+		},
+		{
+			name:  "headless A",
+			qname: "web.default.svc.fleetboard.local.",
+			qType: dns.TypeA,
+			want:  []string{"20.112.0.5"},
+		},
+		{
+			name:  "headless AAAA in cluster",
+			qname: "cluster-a.web.default.svc.fleetboard.local.",
+			qType: dns.TypeAAAA,
+			want:  []string{"fd11::5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answers(query(t, c, tt.qname, tt.qType).Answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeDNSSRV(t *testing.T) {
+	c := newTestCrossDNS(
+		serviceImport("nginx", v1alpha1.ClusterSetIP, "10.96.0.10"),
+		serviceImport("kafka", v1alpha1.Headless),
+		endpointSlice("kafka-a", "kafka", "cluster-a", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.112.0.5"}, Hostname: ptr.To("kafka-0")}),
+		endpointSlice("kafka-b", "kafka", "cluster-b", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.113.0.7"}}),
+	)
+	tests := []struct {
+		name       string
+		qname      string
+		wantAnswer []string
+		wantExtra  []string
+	}{
+		{
+			name:       "clusterset ip named port",
+			qname:      "_grpc._tcp.nginx.default.svc.fleetboard.local.",
+			wantAnswer: []string{"0 100 9090 nginx.default.svc.fleetboard.local."},
+			wantExtra:  []string{},
+		},
+		{
+			name:  "clusterset ip all ports",
+			qname: "nginx.default.svc.fleetboard.local.",
+			wantAnswer: []string{
+				"0 50 8080 nginx.default.svc.fleetboard.local.",
+				"0 50 9090 nginx.default.svc.fleetboard.local.",
+			},
+			wantExtra: []string{},
+		},
+		{
+			name:  "headless",
+			qname: "_grpc._tcp.kafka.default.svc.fleetboard.local.",
+			wantAnswer: []string{
+				"0 50 9090 20-113-0-7.cluster-b.kafka.default.svc.fleetboard.local.",
+				"0 50 9090 kafka-0.cluster-a.kafka.default.svc.fleetboard.local.",
+			},
+			wantExtra: []string{"20.112.0.5", "20.113.0.7"},
+		},
+		{
+			name:       "headless in cluster",
+			qname:      "_grpc._tcp.cluster-a.kafka.default.svc.fleetboard.local.",
+			wantAnswer: []string{"0 100 9090 kafka-0.cluster-a.kafka.default.svc.fleetboard.local."},
+			wantExtra:  []string{"20.112.0.5"},
+		},
+		{
+			name:       "unknown port",
+			qname:      "_http._tcp.kafka.default.svc.fleetboard.local.",
+			wantAnswer: []string{},
+			wantExtra:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := query(t, c, tt.qname, dns.TypeSRV)
+			if got := answers(msg.Answer); !reflect.DeepEqual(got, tt.wantAnswer) {
+				t.Errorf("answers = %v, want %v", got, tt.wantAnswer)
+			}
+			if got := answers(msg.Extra); !reflect.DeepEqual(got, tt.wantExtra) {
+				t.Errorf("extra = %v, want %v", got, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestServeDNSHostname(t *testing.T) {
+	c := newTestCrossDNS(
+		serviceImport("nginx", v1alpha1.ClusterSetIP, "10.96.0.10"),
+		serviceImport("web", v1alpha1.Headless),
+		endpointSlice("web-a", "web", "cluster-a", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.112.0.5"}, Hostname: ptr.To("web-0")},
+			v1.Endpoint{Addresses: []string{"20.112.0.6"}, Hostname: ptr.To("web-1")},
+			v1.Endpoint{
+				Addresses: []string{"20.112.0.7"},
+				TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "web-7d9f5-x2k4p"},
+			}),
+		endpointSlice("web-b", "web", "cluster-b", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.113.0.5"}, Hostname: ptr.To("web-0")}),
+	)
+	tests := []struct {
+		name  string
+		qname string
+		want  []string
+	}{
+		{
+			name:  "stateful pod",
+			qname: "web-0.cluster-a.web.default.svc.fleetboard.local.",
+			want:  []string{"20.112.0.5"},
+		},
+		{
+			name:  "same hostname in another cluster",
+			qname: "web-0.cluster-b.web.default.svc.fleetboard.local.",
+			want:  []string{"20.113.0.5"},
+		},
+		{
+			name:  "pod name without hostname",
+			qname: "web-7d9f5-x2k4p.cluster-a.web.default.svc.fleetboard.local.",
+			want:  []string{"20.112.0.7"},
+		},
+		{
+			name:  "unknown hostname",
+			qname: "web-2.cluster-a.web.default.svc.fleetboard.local.",
+			want:  []string{},
+		},
+		{
+			name:  "clusterset ip service",
+			qname: "web-0.cluster-a.nginx.default.svc.fleetboard.local.",
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answers(query(t, c, tt.qname, dns.TypeA).Answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeDNSEndpointConditions(t *testing.T) {
+	terminating := v1.EndpointConditions{Ready: ptr.To(false), Serving: ptr.To(true), Terminating: ptr.To(true)}
+	notReady := v1.EndpointConditions{Ready: ptr.To(false)}
+	c := newTestCrossDNS(
+		serviceImport("web", v1alpha1.Headless),
+		endpointSlice("web-a", "web", "cluster-a", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.112.0.5", "20.112.0.15"}},
+			v1.Endpoint{Addresses: []string{"20.112.0.6"}, Conditions: notReady},
+			v1.Endpoint{Addresses: []string{"20.112.0.7"}, Conditions: terminating},
+			v1.Endpoint{}),
+		endpointSlice("web-b", "web", "cluster-b", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.113.0.6"}, Conditions: notReady},
+			v1.Endpoint{Addresses: []string{"20.113.0.7"}, Conditions: terminating}),
+		endpointSlice("web-c", "web", "cluster-c", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.114.0.6"}, Conditions: notReady}),
+	)
+	tests := []struct {
+		name  string
+		qname string
+		want  []string
+	}{
+		{
+			name:  "ready endpoints only",
+			qname: "cluster-a.web.default.svc.fleetboard.local.",
+			want:  []string{"20.112.0.15", "20.112.0.5"},
+		},
+		{
+			name:  "serving terminating endpoints without ready ones",
+			qname: "cluster-b.web.default.svc.fleetboard.local.",
+			want:  []string{"20.113.0.7"},
+		},
+		{
+			name:  "no serving endpoints",
+			qname: "cluster-c.web.default.svc.fleetboard.local.",
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answers(query(t, c, tt.qname, dns.TypeA).Answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeDNSReverse(t *testing.T) {
+	cnfPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cnf-0",
+			Namespace: known.FleetboardSystemNamespace,
+			Annotations: map[string]string{
+				known.FleetboardTunnelCIDR:  "20.112.0.0/12",
+				known.FleetboardServiceCIDR: "10.96.100.0/24",
+			},
+		},
+	}
+	c := newTestCrossDNS(
+		cnfPod,
+		serviceImport("nginx", v1alpha1.ClusterSetIP, "10.96.100.10"),
+		serviceImport("web", v1alpha1.Headless),
+		endpointSlice("web-a", "web", "cluster-a", v1.AddressTypeIPv4,
+			v1.Endpoint{Addresses: []string{"20.112.0.5"}, Hostname: ptr.To("web-0")},
+			v1.Endpoint{Addresses: []string{"20.112.0.6"}}),
+	)
+	tests := []struct {
+		name  string
+		qname string
+		want  []string
+	}{
+		{
+			name:  "clusterset ip",
+			qname: "10.100.96.10.in-addr.arpa.",
+			want:  []string{"nginx.default.svc.fleetboard.local."},
+		},
+		{
+			name:  "parallel ip with hostname",
+			qname: "5.0.112.20.in-addr.arpa.",
+			want:  []string{"web-0.cluster-a.web.default.svc.fleetboard.local."},
+		},
+		{
+			name:  "parallel ip without hostname",
+			qname: "6.0.112.20.in-addr.arpa.",
+			want:  []string{"20-112-0-6.cluster-a.web.default.svc.fleetboard.local."},
+		},
+		{
+			name:  "unknown ip in cidr",
+			qname: "9.0.112.20.in-addr.arpa.",
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answers(query(t, c, tt.qname, dns.TypePTR).Answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// ips out of fleetboard cidrs are left to the next plugin.
+	r := new(dns.Msg)
+	r.SetQuestion("1.1.168.192.in-addr.arpa.", dns.TypePTR)
+	if _, err := c.ServeDNS(context.Background(), &responseWriter{}, r); err == nil {
+		t.Errorf("ServeDNS() of an ip out of fleetboard cidrs is answered")
+	}
+}
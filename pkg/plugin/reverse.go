@@ -0,0 +1,154 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	v1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/request"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// ipIndex indexes service imports by clusterset ips and imported endpoint slices by endpoint addresses.
+const ipIndex = "ip"
+
+func serviceImportIPIndexFunc(obj interface{}) ([]string, error) {
+	si, ok := obj.(*v1alpha1.ServiceImport)
+	if !ok {
+		return nil, nil
+	}
+	return si.Spec.IPs, nil
+}
+
+func endpointSliceIPIndexFunc(obj interface{}) ([]string, error) {
+	eps, ok := obj.(*v1.EndpointSlice)
+	if !ok || eps.AddressType == v1.AddressTypeFQDN || len(eps.Labels[known.LabelServiceName]) == 0 {
+		return nil, nil
+	}
+	ips := make([]string, 0)
+	for _, endpoint := range eps.Endpoints {
+		ips = append(ips, endpoint.Addresses...)
+	}
+	return ips, nil
+}
+
+// serveReverse answers PTR queries of parallel ips and clusterset ips, others go to the next plugin.
+func (c *CrossDNS) serveReverse(ctx context.Context, state *request.Request) (int, error) {
+	ip := net.ParseIP(dnsutil.ExtractAddressFromReverse(state.Name()))
+	zone := c.forwardZone()
+	if ip == nil || zone == "" {
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, state.W, state.Req)
+	}
+	// wait for endpoint slice synced.
+	if !cache.WaitForCacheSync(ctx.Done(), c.epsSynced, c.SISynced, c.cnfPodSynced) {
+		return dns.RcodeServerFailure, errors.New("unable to sync caches for reverse lookup")
+	}
+	if !c.inReverseCIDRs(ip) {
+		klog.Infof("Reverse request %q is not for fleetboard ips", state.QName())
+		return plugin.NextOrFailure(c.Name(), c.Next, ctx, state.W, state.Req)
+	}
+
+	names, err := c.reverseNames(ip.String(), zone)
+	if err != nil {
+		klog.Errorf("Failed to look up names of %s: %v", ip, err)
+		return dns.RcodeServerFailure, errors.New("failed to write response")
+	}
+	if len(names) == 0 {
+		klog.Infof("Couldn't find a service or endpoint for %q", state.QName())
+		return c.emptyResponse(state)
+	}
+
+	a := new(dns.Msg)
+	a.SetReply(state.Req)
+	for _, name := range names {
+		a.Answer = append(a.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{
+				Name: state.QName(), Rrtype: dns.TypePTR, Class: state.QClass(),
+				Ttl: defaultTTL,
+			},
+			Ptr: name,
+		})
+	}
+	klog.Infof("Responding to query with '%s'", a.Answer)
+	return writeResponse(state, a)
+}
+
+// reverseNames are names of the clusterset ip or endpoint address ip, sorted.
+func (c *CrossDNS) reverseNames(ip, zone string) ([]string, error) {
+	names := make(map[string]bool)
+	serviceImports, err := c.siIndexer.ByIndex(ipIndex, ip)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range serviceImports {
+		si := obj.(*v1alpha1.ServiceImport)
+		if si.Spec.Type == v1alpha1.ClusterSetIP {
+			names[dnsutil.Join(si.Name, si.Namespace, Svc, zone)] = true
+		}
+	}
+
+	slices, err := c.epsIndexer.ByIndex(ipIndex, ip)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range slices {
+		eps := obj.(*v1.EndpointSlice)
+		for _, endpoint := range eps.Endpoints {
+			for _, address := range endpoint.Addresses {
+				if address != ip {
+					continue
+				}
+				names[dnsutil.Join(endpointHostname(endpoint), eps.Labels[known.LabelClusterID],
+					eps.Labels[known.LabelServiceName], eps.Labels[known.LabelServiceNameSpace], Svc, zone)] = true
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// forwardZone is the first zone not for reverse lookups, names of ips are in it.
+func (c *CrossDNS) forwardZone() string {
+	for _, zone := range c.Zones {
+		if !isReverseZone(zone) {
+			return zone
+		}
+	}
+	return ""
+}
+
+func isReverseZone(zone string) bool {
+	return dns.IsSubDomain("in-addr.arpa.", zone) || dns.IsSubDomain("ip6.arpa.", zone)
+}
+
+// inReverseCIDRs tells if ip is in the tunnel cidr or the virtual service cidr, they are found in cnf pods.
+func (c *CrossDNS) inReverseCIDRs(ip net.IP) bool {
+	pods, err := c.cnfPodLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("Failed to list cnf pods: %v", err)
+		return false
+	}
+	for _, pod := range pods {
+		for _, key := range []string{known.FleetboardTunnelCIDR, known.FleetboardServiceCIDR} {
+			if _, cidr, errParse := net.ParseCIDR(pod.Annotations[key]); errParse == nil && cidr.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -3,7 +3,9 @@ package plugin
 import (
 	"flag"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	mcsclientset "sigs.k8s.io/mcs-api/pkg/client/clientset/versioned"
 	mcsInformers "sigs.k8s.io/mcs-api/pkg/client/informers/externalversions"
@@ -63,16 +65,37 @@ func CrossDNSParse(c *caddy.Controller) (*CrossDNS, error) {
 	mcsClientSet := mcsclientset.NewForConfigOrDie(cfg)
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, known.DefaultResync)
 	mcsInformerFactory := mcsInformers.NewSharedInformerFactory(mcsClientSet, known.DefaultResync)
+	// cnf pods tell the tunnel cidr and the virtual service cidr, reverse lookups are answered for them.
+	cnfInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, known.DefaultResync,
+		kubeinformers.WithNamespace(known.FleetboardSystemNamespace),
+		kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = known.LabelCNFPod
+		}))
 	endpointSlicesInformer := kubeInformerFactory.Discovery().V1().EndpointSlices()
 	siInformer := mcsInformerFactory.Multicluster().V1alpha1().ServiceImports()
+	cnfPodInformer := cnfInformerFactory.Core().V1().Pods()
+
+	err = endpointSlicesInformer.Informer().AddIndexers(cache.Indexers{ipIndex: endpointSliceIPIndexFunc})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding ip indexer of endpoint slices")
+	}
+	err = siInformer.Informer().AddIndexers(cache.Indexers{ipIndex: serviceImportIPIndexFunc})
+	if err != nil {
+		return nil, errors.Wrap(err, "error adding ip indexer of service imports")
+	}
 
 	cd.endpointSlicesLister = endpointSlicesInformer.Lister()
 	cd.SILister = siInformer.Lister()
 	cd.epsSynced = endpointSlicesInformer.Informer().HasSynced
 	cd.SISynced = siInformer.Informer().HasSynced
+	cd.epsIndexer = endpointSlicesInformer.Informer().GetIndexer()
+	cd.siIndexer = siInformer.Informer().GetIndexer()
+	cd.cnfPodLister = cnfPodInformer.Lister()
+	cd.cnfPodSynced = cnfPodInformer.Informer().HasSynced
 
 	kubeInformerFactory.Start(stopChannel)
 	mcsInformerFactory.Start(stopChannel)
+	cnfInformerFactory.Start(stopChannel)
 
 	c.OnShutdown(func() error {
 		close(stopChannel)
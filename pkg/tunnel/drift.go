@@ -0,0 +1,257 @@
+package tunnel
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// drift kinds, what is found diverged from the tunnels we hold.
+const (
+	DriftLinkDown     = "link_down"
+	DriftDevice       = "device"
+	DriftMissingPeer  = "missing_peer"
+	DriftAllowedIPs   = "allowed_ips"
+	DriftOrphanPeer   = "orphan_peer"
+	DriftMissingRoute = "missing_route"
+)
+
+// Drift is a divergence found on the device and repaired.
+type Drift struct {
+	Kind string
+	// Target is the cluster, node, public key or cidr diverged.
+	Target string
+}
+
+func (d Drift) String() string {
+	return d.Kind + " " + d.Target
+}
+
+// Reconcile repairs the device and routes through it when they diverge from connections we hold, e.g. after
+// `wg set` by hand, a flushed route or the link set down. Peers nobody holds are removed.
+func (w *Wireguard) Reconcile() ([]Drift, error) {
+	drifts, err := w.reconcileDevice()
+	if err != nil {
+		return drifts, err
+	}
+	routeDrifts, err := w.reconcileRoutes()
+	return append(drifts, routeDrifts...), err
+}
+
+func (w *Wireguard) reconcileDevice() ([]Drift, error) {
+	w.Lock()
+	defer w.Unlock()
+	drifts := make([]Drift, 0)
+
+	link, err := netlink.LinkByName(known.DefaultDeviceName)
+	if err != nil {
+		return drifts, errors.Wrapf(err, "cannot get wireguard link by name %s", known.DefaultDeviceName)
+	}
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		if err = netlink.LinkSetUp(link); err != nil {
+			return drifts, errors.Wrap(err, "failed to bring up WireGuard device")
+		}
+		drifts = append(drifts, Drift{Kind: DriftLinkDown, Target: known.DefaultDeviceName})
+	}
+
+	d, err := w.client.Device(known.DefaultDeviceName)
+	if err != nil {
+		return drifts, errors.Wrap(err, "wgctrl cannot find WireGuard device")
+	}
+	if d.PrivateKey != w.Keys.privateKey || d.ListenPort != known.UDPPort {
+		if err = w.client.ConfigureDevice(known.DefaultDeviceName, wgtypes.Config{
+			PrivateKey: &w.Keys.privateKey,
+			ListenPort: ptr.To(known.UDPPort),
+		}); err != nil {
+			return drifts, errors.Wrap(err, "failed to configure WireGuard device")
+		}
+		drifts = append(drifts, Drift{Kind: DriftDevice, Target: known.DefaultDeviceName})
+	}
+	peerDrifts, err := w.reconcilePeers(d.Peers)
+	return append(drifts, peerDrifts...), err
+}
+
+// reconcilePeers configures peers of connections gone from the device again, fixes allowed ips and removes peers
+// nobody holds, all in one go. Connections are kept whatever happens, so a failed repair is retried next time.
+// Caller must hold the lock.
+func (w *Wireguard) reconcilePeers(peers []wgtypes.Peer) ([]Drift, error) {
+	drifts := make([]Drift, 0)
+	devicePeers := make(map[string]wgtypes.Peer, len(peers))
+	for _, p := range peers {
+		devicePeers[p.PublicKey.String()] = p
+	}
+	desired := w.desiredAllowedIPs()
+	peerCfg := make([]wgtypes.PeerConfig, 0)
+	for key, devicePeer := range devicePeers {
+		allowedIPs, found := desired[key]
+		if !found {
+			klog.Warningf("remove orphaned peer %s from %s", key, known.DefaultDeviceName)
+			drifts = append(drifts, Drift{Kind: DriftOrphanPeer, Target: key})
+			peerCfg = append(peerCfg, wgtypes.PeerConfig{PublicKey: devicePeer.PublicKey, Remove: true})
+			continue
+		}
+		if !sameSubnets(devicePeer.AllowedIPs, allowedIPs) {
+			drifts = append(drifts, Drift{Kind: DriftAllowedIPs, Target: key})
+			peerCfg = append(peerCfg, wgtypes.PeerConfig{
+				PublicKey:         devicePeer.PublicKey,
+				UpdateOnly:        true,
+				ReplaceAllowedIPs: true,
+				AllowedIPs:        allowedIPs,
+			})
+		}
+	}
+
+	var errs []error
+	for id, peer := range w.interConnections {
+		if allOnDevice(PeerKeys(peer), devicePeers) {
+			continue
+		}
+		cfg, err := w.interPeerConfigs(peer, w.presharedKey(peer.Spec.PublicKey))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		drifts = append(drifts, Drift{Kind: DriftMissingPeer, Target: id})
+		peerCfg = append(peerCfg, cfg...)
+	}
+	for nodeID, config := range w.innerConnections {
+		if w.Spec.InnerClusterTransport == TransportIPIP || len(config.PublicKey) == 0 ||
+			allOnDevice(config.Keys(), devicePeers) {
+			continue
+		}
+		cfg, err := innerPeerConfigs(config, w.presharedKey(config.PublicKey[0]))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		drifts = append(drifts, Drift{Kind: DriftMissingPeer, Target: nodeID})
+		peerCfg = append(peerCfg, cfg...)
+	}
+
+	if len(peerCfg) != 0 {
+		if err := w.client.ConfigureDevice(known.DefaultDeviceName, wgtypes.Config{
+			ReplacePeers: false,
+			Peers:        peerCfg,
+		}); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to repair peers"))
+		}
+	}
+	return drifts, utilerrors.NewAggregate(errs)
+}
+
+// desiredAllowedIPs are allowed ips of every peer we hold keyed by public key, caller must hold the lock.
+func (w *Wireguard) desiredAllowedIPs() map[string][]net.IPNet {
+	desired := make(map[string][]net.IPNet)
+	for _, peer := range w.interConnections {
+		for _, key := range PeerKeys(peer) {
+			desired[key] = w.interAllowedIPs(peer, key)
+		}
+	}
+	if w.Spec.InnerClusterTransport == TransportIPIP {
+		return desired
+	}
+	for _, config := range w.innerConnections {
+		if len(config.PublicKey) != 0 {
+			desired[config.PublicKey[0]] = parseSubnets(config.SecondaryCIDR)
+		}
+		if len(config.NextPublicKey) != 0 {
+			// standby until the cnf pod switches to it.
+			desired[config.NextPublicKey] = nil
+		}
+	}
+	return desired
+}
+
+// routedCIDRs are cidrs routed through the device, caller must hold the lock.
+func (w *Wireguard) routedCIDRs() []string {
+	cidrs := sets.New[string]()
+	for _, peer := range w.interConnections {
+		cidrs.Insert(peer.Spec.PodCIDR...)
+		for _, key := range GatewayKeys(peer) {
+			cidrs.Insert(w.router.AllowedIPs(peer, key)...)
+		}
+	}
+	// with ip-in-ip or multiple gateways, inner cluster routes go through the ip-in-ip device.
+	if w.Spec.InnerClusterTransport != TransportIPIP && !w.Spec.MultiGateway() {
+		for _, config := range w.innerConnections {
+			cidrs.Insert(config.SecondaryCIDR...)
+		}
+	}
+	return sets.List(cidrs)
+}
+
+// reconcileRoutes adds routes through the device which are gone, extra routes are left alone.
+func (w *Wireguard) reconcileRoutes() ([]Drift, error) {
+	w.Lock()
+	cidrs := w.routedCIDRs()
+	w.Unlock()
+	drifts := make([]Drift, 0)
+	link, err := netlink.LinkByName(known.DefaultDeviceName)
+	if err != nil {
+		return drifts, errors.Wrapf(err, "cannot get wireguard link by name %s", known.DefaultDeviceName)
+	}
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return drifts, errors.Wrapf(err, "failed to list routes of %s", known.DefaultDeviceName)
+	}
+	existing := sets.New[string]()
+	for _, route := range routes {
+		if route.Dst != nil {
+			existing.Insert(route.Dst.String())
+		}
+	}
+	for _, dst := range parseSubnets(cidrs) {
+		if existing.Has(dst.String()) {
+			continue
+		}
+		route := netlink.Route{
+			Dst:       ptr.To(dst),
+			LinkIndex: link.Attrs().Index,
+			Protocol:  4,
+			Scope:     unix.RT_SCOPE_LINK,
+		}
+		if err = netlink.RouteAdd(&route); err != nil && !os.IsExist(err) {
+			return drifts, errors.Wrapf(err, "failed to add route %s", dst.String())
+		}
+		drifts = append(drifts, Drift{Kind: DriftMissingRoute, Target: dst.String()})
+	}
+	return drifts, nil
+}
+
+// presharedKey is the pre-shared key the peer is configured with, nil if none, caller must hold the lock.
+func (w *Wireguard) presharedKey(remoteKey string) *wgtypes.Key {
+	if psk, found := w.presharedKeys[remoteKey]; found {
+		return ptr.To(psk)
+	}
+	return nil
+}
+
+func allOnDevice(keys []string, devicePeers map[string]wgtypes.Peer) bool {
+	for _, key := range keys {
+		if _, found := devicePeers[key]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSubnets(a, b []net.IPNet) bool {
+	as, bs := sets.New[string](), sets.New[string]()
+	for _, n := range a {
+		as.Insert(n.String())
+	}
+	for _, n := range b {
+		bs.Insert(n.String())
+	}
+	return as.Equal(bs)
+}
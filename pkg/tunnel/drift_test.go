@@ -0,0 +1,167 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+// relayRouter routes cidrs of every peer to it, and relayed cidrs to the relays as well.
+type relayRouter map[string][]string
+
+func (r relayRouter) AllowedIPs(peer *v1alpha1.Peer, _ string) []string {
+	return append(append([]string{}, peer.Spec.PodCIDR...), r[peer.Spec.ClusterID]...)
+}
+
+func (r relayRouter) Endpoint(_ *v1alpha1.Peer) *net.UDPAddr {
+	return nil
+}
+
+func TestRoutedCIDRs(t *testing.T) {
+	interConnections := map[string]*v1alpha1.Peer{
+		"hub":       {Spec: v1alpha1.PeerSpec{ClusterID: "hub", PodCIDR: []string{"20.112.0.0/12"}, IsHub: true}},
+		"cluster-2": {Spec: v1alpha1.PeerSpec{ClusterID: "cluster-2", PodCIDR: []string{"20.113.0.0/16"}}},
+	}
+	innerConnections := map[string]*DaemonCNFTunnelConfig{
+		"node-b": {NodeID: "node-b", SecondaryCIDR: []string{"20.114.1.0/24"}},
+	}
+	tests := []struct {
+		name string
+		spec Specification
+		want []string
+	}{
+		{
+			name: "leader routes peers and cnf pods",
+			spec: Specification{Options: Options{InnerClusterTransport: TransportWireguard, GatewayReplicas: 1}},
+			want: []string{"20.112.0.0/12", "20.113.0.0/16", "20.114.1.0/24", "20.115.0.0/16"},
+		},
+		{
+			name: "cnf pods go through ip-in-ip with multiple gateways",
+			spec: Specification{Options: Options{InnerClusterTransport: TransportWireguard, GatewayReplicas: 2}},
+			want: []string{"20.112.0.0/12", "20.113.0.0/16", "20.115.0.0/16"},
+		},
+		{
+			name: "cnf pods go through ip-in-ip transport",
+			spec: Specification{Options: Options{InnerClusterTransport: TransportIPIP, GatewayReplicas: 1}},
+			want: []string{"20.112.0.0/12", "20.113.0.0/16", "20.115.0.0/16"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			w := &Wireguard{
+				interConnections: interConnections,
+				innerConnections: innerConnections,
+				router:           relayRouter{"cluster-2": {"20.115.0.0/16"}},
+				Spec:             &spec,
+			}
+			if got := w.routedCIDRs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routedCIDRs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingClient fails to configure the device, e.g. when the link is gone meanwhile.
+type failingClient struct {
+	*fakeClient
+}
+
+func (f failingClient) ConfigureDevice(_ string, _ wgtypes.Config) error {
+	return fmt.Errorf("no such device")
+}
+
+func TestReconcilePeers(t *testing.T) {
+	peerKey, nodeKey, orphanKey := newTestKey(t).PublicKey(), newTestKey(t).PublicKey(), newTestKey(t).PublicKey()
+	tests := []struct {
+		name        string
+		devicePeers []wgtypes.Peer
+		fail        bool
+		wantDrifts  []string
+		wantPeers   []string
+		wantErr     bool
+	}{
+		{
+			name:        "missing peers are configured again",
+			devicePeers: nil,
+			wantDrifts:  []string{"missing_peer cluster-2", "missing_peer node-b"},
+			wantPeers:   []string{peerKey.String(), nodeKey.String()},
+		},
+		{
+			name:        "failed repair keeps connections",
+			devicePeers: nil,
+			fail:        true,
+			wantDrifts:  []string{"missing_peer cluster-2", "missing_peer node-b"},
+			wantErr:     true,
+		},
+		{
+			name: "orphan peer is removed",
+			devicePeers: []wgtypes.Peer{
+				{PublicKey: peerKey, AllowedIPs: parseSubnets([]string{"20.113.0.0/16"})},
+				{PublicKey: nodeKey, AllowedIPs: parseSubnets([]string{"20.114.1.0/24"})},
+				{PublicKey: orphanKey},
+			},
+			wantDrifts: []string{"orphan_peer " + orphanKey.String()},
+			wantPeers:  []string{peerKey.String(), nodeKey.String()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &fakeClient{device: wgtypes.Device{Peers: tt.devicePeers}}
+			var client wgClient = device
+			if tt.fail {
+				client = failingClient{device}
+			}
+			w := &Wireguard{
+				interConnections: map[string]*v1alpha1.Peer{
+					"cluster-2": {Spec: v1alpha1.PeerSpec{ClusterID: "cluster-2", PublicKey: peerKey.String(),
+						PodCIDR: []string{"20.113.0.0/16"}}},
+				},
+				innerConnections: map[string]*DaemonCNFTunnelConfig{
+					"node-b": {NodeID: "node-b", PublicKey: []string{nodeKey.String()}, endpointIP: "10.0.0.2",
+						port: 31820, SecondaryCIDR: []string{"20.114.1.0/24"}},
+				},
+				presharedKeys: make(map[string]wgtypes.Key),
+				router:        relayRouter{},
+				client:        client,
+				Spec:          &Specification{Options: Options{InnerClusterTransport: TransportWireguard}},
+			}
+
+			drifts, err := w.reconcilePeers(device.device.Peers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reconcilePeers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			gotDrifts := make([]string, 0, len(drifts))
+			for _, drift := range drifts {
+				gotDrifts = append(gotDrifts, drift.String())
+			}
+			sort.Strings(gotDrifts)
+			if !reflect.DeepEqual(gotDrifts, tt.wantDrifts) {
+				t.Errorf("drifts = %v, want %v", gotDrifts, tt.wantDrifts)
+			}
+			if len(w.interConnections) != 1 || len(w.innerConnections) != 1 {
+				t.Errorf("connections are forgotten, inter %v, inner %v", w.interConnections, w.innerConnections)
+			}
+			if tt.fail {
+				return
+			}
+			gotPeers := make([]string, 0, len(device.device.Peers))
+			for _, peer := range device.device.Peers {
+				gotPeers = append(gotPeers, peer.PublicKey.String())
+			}
+			if !sets.New(gotPeers...).Equal(sets.New(tt.wantPeers...)) {
+				t.Errorf("device peers = %v, want %v", gotPeers, tt.wantPeers)
+			}
+			if drifts, _ = w.reconcilePeers(device.device.Peers); len(drifts) != 0 {
+				t.Errorf("device still drifts after repair: %v", drifts)
+			}
+		})
+	}
+}
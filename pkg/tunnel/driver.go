@@ -0,0 +1,62 @@
+package tunnel
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+// tunnel drivers
+const (
+	// DriverKernel uses the wire-guard kernel module.
+	DriverKernel = "kernel"
+	// DriverUserspace uses wireguard-go with a TUN device, for nodes without the kernel module.
+	DriverUserspace = "userspace"
+)
+
+// TunnelDriver manages the wire-guard device of a cnf pod and tunnels on it.
+type TunnelDriver interface {
+	// Init brings the device up and publishes the public key of this cnf pod.
+	Init(client kubernetes.Interface) error
+	// Close releases what the driver holds, the device and its peers stay for the next cnf pod.
+	Close() error
+	// Cleanup releases the device and removes it.
+	Cleanup() error
+
+	AddInterClusterTunnel(peer *v1alpha1.Peer, psk *wgtypes.Key) error
+	RemoveInterClusterTunnel(key *wgtypes.Key) error
+	AddInnerClusterTunnel(daemonPeerConfig *DaemonCNFTunnelConfig, psk *wgtypes.Key) error
+	RemoveInnerClusterTunnel(key *wgtypes.Key) error
+
+	GetAllExistingInterConnection() map[string]*v1alpha1.Peer
+	GetAllExistingInnerConnection() map[string]*DaemonCNFTunnelConfig
+	GetExistingInnerConnection(nodeID string) (*DaemonCNFTunnelConfig, bool)
+	DeleteExistingInnerConnection(nodeID string)
+	DeleteExistingInterConnection(clusterID string)
+
+	// SetRouter hands the topology of inter cluster peers to controllers.
+	SetRouter(router Router)
+	// Refresh configures the given peers again after router has changed, the last one owns cidrs they share.
+	Refresh(clusterIDs ...string) error
+
+	// PublicKey is the current public key of this cnf pod.
+	PublicKey() wgtypes.Key
+	// NextPublicKey is published ahead of a key rotation, empty if none.
+	NextPublicKey() string
+	KeyRotationDue(interval time.Duration, now time.Time) bool
+	RotateKey(k8sClient kubernetes.Interface) error
+	ConfirmKeyRotation(k8sClient kubernetes.Interface, gracePeriod time.Duration) (published bool, err error)
+
+	// DevicePeers returns peer stats on the device, keyed by public key.
+	DevicePeers() (map[string]wgtypes.Peer, error)
+	// Reconcile repairs the device and its routes when they diverge from connections held.
+	Reconcile() ([]Drift, error)
+}
+
+var (
+	_ TunnelDriver = &Wireguard{}
+	_ TunnelDriver = &userspaceWireguard{}
+)
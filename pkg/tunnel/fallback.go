@@ -0,0 +1,262 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+)
+
+// fallback transports carry wire-guard datagrams when udp is blocked on the way.
+const (
+	// FallbackTCP frames every datagram with its 2 bytes length on a tcp stream.
+	FallbackTCP = "tcp"
+	// FallbackWSS sends every datagram as a binary message over websocket over tls, looks like https.
+	FallbackWSS = "wss"
+
+	fallbackPath        = "/fleetboard"
+	fallbackDialTimeout = 10 * time.Second
+	maxDatagramSize     = 65535
+)
+
+// datagramConn keeps datagram boundaries over a stream.
+type datagramConn interface {
+	ReadDatagram() ([]byte, error)
+	WriteDatagram(b []byte) error
+	Close() error
+}
+
+type framedConn struct {
+	net.Conn
+}
+
+func (c framedConn) ReadDatagram() ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(c.Conn, size[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(c.Conn, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c framedConn) WriteDatagram(b []byte) error {
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+type websocketConn struct {
+	*websocket.Conn
+}
+
+func (c websocketConn) ReadDatagram() ([]byte, error) {
+	for {
+		messageType, b, err := c.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if messageType == websocket.BinaryMessage {
+			return b, nil
+		}
+	}
+}
+
+func (c websocketConn) WriteDatagram(b []byte) error {
+	return c.WriteMessage(websocket.BinaryMessage, b)
+}
+
+// ServeFallback accepts fallback connections on port and hands their datagrams to the local wire-guard device.
+func ServeFallback(ctx context.Context, transport string, port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on fallback port %d", port)
+	}
+	wgAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: known.UDPPort}
+	klog.Infof("serving %s fallback transport on port %d", transport, port)
+	return serveFallback(ctx, listener, transport, wgAddr)
+}
+
+func serveFallback(ctx context.Context, listener net.Listener, transport string, wgAddr *net.UDPAddr) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	if transport == FallbackWSS {
+		certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey(known.Fleetboard, nil, nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate fallback certificate")
+		}
+		certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return errors.Wrap(err, "failed to load fallback certificate")
+		}
+		upgrader := websocket.Upgrader{
+			ReadBufferSize:  maxDatagramSize,
+			WriteBufferSize: maxDatagramSize,
+			CheckOrigin:     func(r *http.Request) bool { return true },
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc(fallbackPath, func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				klog.V(4).Infof("fallback upgrade from %s failed: %v", r.RemoteAddr, err)
+				return
+			}
+			relayToDevice(websocketConn{conn}, wgAddr)
+		})
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: fallbackDialTimeout}
+		err = server.Serve(tls.NewListener(listener, &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		}))
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "failed to accept fallback connection")
+		}
+		go relayToDevice(framedConn{conn}, wgAddr)
+	}
+}
+
+// relayToDevice pipes datagrams of one fallback connection with the wire-guard device through a udp socket
+// of its own, so the device sees every remote peer at a distinct loopback endpoint.
+func relayToDevice(conn datagramConn, wgAddr *net.UDPAddr) {
+	udp, err := net.DialUDP("udp", nil, wgAddr)
+	if err != nil {
+		klog.Errorf("failed to dial wireguard device: %v", err)
+		_ = conn.Close()
+		return
+	}
+	pipeDatagrams(conn, udp, func(b []byte) error {
+		_, err := udp.Write(b)
+		return err
+	}, func(buf []byte) (int, error) {
+		return udp.Read(buf)
+	})
+}
+
+// pipeDatagrams copies datagrams both ways until either side fails, then closes both.
+func pipeDatagrams(conn datagramConn, udp *net.UDPConn, writeUDP func([]byte) error,
+	readUDP func([]byte) (int, error)) {
+	var once sync.Once
+	closeAll := func() {
+		once.Do(func() {
+			_ = conn.Close()
+			_ = udp.Close()
+		})
+	}
+	go func() {
+		defer closeAll()
+		for {
+			b, err := conn.ReadDatagram()
+			if err != nil {
+				return
+			}
+			if err = writeUDP(b); err != nil {
+				return
+			}
+		}
+	}()
+	defer closeAll()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := readUDP(buf)
+		if err != nil {
+			return
+		}
+		if err = conn.WriteDatagram(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+// FallbackClient is a loopback udp endpoint standing for a remote peer, set as the peer endpoint on the device.
+type FallbackClient struct {
+	local *net.UDPConn
+}
+
+func (c *FallbackClient) LocalAddr() *net.UDPAddr {
+	return c.local.LocalAddr().(*net.UDPAddr)
+}
+
+func (c *FallbackClient) Close() error {
+	return c.local.Close()
+}
+
+// DialFallback connects the fallback transport of a peer served at address, datagrams go to and come from the
+// local wire-guard device.
+func DialFallback(transport, address string) (*FallbackClient, error) {
+	return dialFallback(transport, address, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: known.UDPPort})
+}
+
+func dialFallback(transport, address string, wgAddr *net.UDPAddr) (*FallbackClient, error) {
+	var conn datagramConn
+	switch transport {
+	case FallbackTCP:
+		c, err := net.DialTimeout("tcp", address, fallbackDialTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to dial tcp fallback %s", address)
+		}
+		conn = framedConn{c}
+	case FallbackWSS:
+		dialer := websocket.Dialer{
+			HandshakeTimeout: fallbackDialTimeout,
+			ReadBufferSize:   maxDatagramSize,
+			WriteBufferSize:  maxDatagramSize,
+			// peers are authenticated by wire-guard, tls only makes the traffic look like https.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12}, //nolint:gosec
+		}
+		c, _, err := dialer.Dial("wss://"+address+fallbackPath, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to dial websocket fallback %s", address)
+		}
+		conn = websocketConn{c}
+	default:
+		return nil, errors.Errorf("unknown fallback transport %q", transport)
+	}
+
+	local, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "failed to listen fallback udp endpoint")
+	}
+	go pipeDatagrams(conn, local, func(b []byte) error {
+		_, err := local.WriteToUDP(b, wgAddr)
+		return err
+	}, func(buf []byte) (int, error) {
+		for {
+			n, from, err := local.ReadFromUDP(buf)
+			if err != nil || from.Port == wgAddr.Port {
+				return n, err
+			}
+		}
+	})
+	return &FallbackClient{local: local}, nil
+}
@@ -0,0 +1,68 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFallbackTransport(t *testing.T) {
+	for _, transport := range []string{FallbackTCP, FallbackWSS} {
+		t.Run(transport, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// remote wire-guard device echoes datagrams back.
+			remoteDevice, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer remoteDevice.Close()
+			go func() {
+				buf := make([]byte, maxDatagramSize)
+				for {
+					n, from, errRead := remoteDevice.ReadFromUDP(buf)
+					if errRead != nil {
+						return
+					}
+					_, _ = remoteDevice.WriteToUDP(buf[:n], from)
+				}
+			}()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				_ = serveFallback(ctx, listener, transport, remoteDevice.LocalAddr().(*net.UDPAddr))
+			}()
+
+			localDevice, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer localDevice.Close()
+			client, err := dialFallback(transport, listener.Addr().String(), localDevice.LocalAddr().(*net.UDPAddr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			for _, datagram := range []string{"handshake", "data"} {
+				if _, err = localDevice.WriteToUDP([]byte(datagram), client.LocalAddr()); err != nil {
+					t.Fatal(err)
+				}
+				_ = localDevice.SetReadDeadline(time.Now().Add(5 * time.Second))
+				buf := make([]byte, maxDatagramSize)
+				n, _, errRead := localDevice.ReadFromUDP(buf)
+				if errRead != nil {
+					t.Fatal(errRead)
+				}
+				if got := string(buf[:n]); got != datagram {
+					t.Errorf("got datagram %q, want %q", got, datagram)
+				}
+			}
+		})
+	}
+}
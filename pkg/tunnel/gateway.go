@@ -0,0 +1,122 @@
+package tunnel
+
+import (
+	"net"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/pkg/errors"
+)
+
+// GatewayKeys are public keys of all the gateways of peer, the one in peer spec goes first.
+func GatewayKeys(peer *v1alpha1.Peer) []string {
+	keys := make([]string, 0, 1+len(peer.Spec.Gateways))
+	keys = append(keys, peer.Spec.PublicKey)
+	for _, gateway := range peer.Spec.Gateways {
+		keys = append(keys, gateway.PublicKey)
+	}
+	return keys
+}
+
+// NextKeys are next keys the gateways of peer publish ahead of their key rotation.
+func NextKeys(peer *v1alpha1.Peer) []string {
+	keys := make([]string, 0)
+	if len(peer.Spec.NextPublicKey) != 0 {
+		keys = append(keys, peer.Spec.NextPublicKey)
+	}
+	for _, gateway := range peer.Spec.Gateways {
+		if len(gateway.NextPublicKey) != 0 {
+			keys = append(keys, gateway.NextPublicKey)
+		}
+	}
+	return keys
+}
+
+// PeerKeys are all the keys of peer on the device, gateway keys first and then next keys.
+func PeerKeys(peer *v1alpha1.Peer) []string {
+	return append(GatewayKeys(peer), NextKeys(peer)...)
+}
+
+// gatewayPeerConfigs connects the additional gateways of peer, caller must hold the lock.
+func (w *Wireguard) gatewayPeerConfigs(peer *v1alpha1.Peer, psk *wgtypes.Key) ([]wgtypes.PeerConfig, error) {
+	ka := 10 * time.Second
+	peerCfg := make([]wgtypes.PeerConfig, 0, len(peer.Spec.Gateways))
+	for _, gateway := range peer.Spec.Gateways {
+		key, err := wgtypes.ParseKey(gateway.PublicKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public key of gateway %s of peer %s", gateway.Name,
+				peer.Spec.ClusterID)
+		}
+		var endpoint *net.UDPAddr
+		if ip := net.ParseIP(gateway.Endpoint); ip != nil {
+			endpoint = &net.UDPAddr{IP: ip, Port: gateway.Port}
+		}
+		peerCfg = append(peerCfg, wgtypes.PeerConfig{
+			PublicKey:                   key,
+			PresharedKey:                presharedKeyOrZero(psk),
+			Endpoint:                    endpoint,
+			PersistentKeepaliveInterval: &ka,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  w.interAllowedIPs(peer, gateway.PublicKey),
+		})
+	}
+	return peerCfg, nil
+}
+
+// nextKeyPeerConfigs connects next keys of the gateways of peer as standby peers without allowed ips, so the
+// tunnel is ready when a gateway switches to its next key. Endpoint is where the gateway in spec is dialed.
+func nextKeyPeerConfigs(peer *v1alpha1.Peer, endpoint *net.UDPAddr, psk *wgtypes.Key) ([]wgtypes.PeerConfig,
+	error) {
+	ka := 10 * time.Second
+	peerCfg := make([]wgtypes.PeerConfig, 0)
+	add := func(nextKey string, endpoint *net.UDPAddr) error {
+		if len(nextKey) == 0 {
+			return nil
+		}
+		key, err := wgtypes.ParseKey(nextKey)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse next key of peer %s", peer.Spec.ClusterID)
+		}
+		peerCfg = append(peerCfg, wgtypes.PeerConfig{
+			PublicKey:                   key,
+			PresharedKey:                presharedKeyOrZero(psk),
+			Endpoint:                    endpoint,
+			PersistentKeepaliveInterval: &ka,
+			ReplaceAllowedIPs:           true,
+		})
+		return nil
+	}
+	if err := add(peer.Spec.NextPublicKey, endpoint); err != nil {
+		return nil, err
+	}
+	for _, gateway := range peer.Spec.Gateways {
+		var gatewayEndpoint *net.UDPAddr
+		if ip := net.ParseIP(gateway.Endpoint); ip != nil {
+			gatewayEndpoint = &net.UDPAddr{IP: ip, Port: gateway.Port}
+		}
+		if err := add(gateway.NextPublicKey, gatewayEndpoint); err != nil {
+			return nil, err
+		}
+	}
+	return peerCfg, nil
+}
+
+// removedGatewayConfigs removes gateways and next keys of oldPeer which are gone in newPeer.
+func removedGatewayConfigs(oldPeer, newPeer *v1alpha1.Peer) []wgtypes.PeerConfig {
+	kept := make(map[string]struct{})
+	for _, key := range PeerKeys(newPeer) {
+		kept[key] = struct{}{}
+	}
+	peerCfg := make([]wgtypes.PeerConfig, 0)
+	for _, oldKey := range PeerKeys(oldPeer)[1:] {
+		if _, found := kept[oldKey]; found {
+			continue
+		}
+		if key, err := wgtypes.ParseKey(oldKey); err == nil {
+			peerCfg = append(peerCfg, wgtypes.PeerConfig{PublicKey: key, Remove: true})
+		}
+	}
+	return peerCfg
+}
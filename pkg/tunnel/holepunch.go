@@ -0,0 +1,36 @@
+package tunnel
+
+import (
+	"net"
+
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+// HolePunchingPeer tells if we reach peer through nat hole punching: both sides are child clusters without
+// endpoint, and they dial the endpoints hub observed for each other.
+func HolePunchingPeer(spec *Specification, peer *v1alpha1.Peer) bool {
+	if !spec.EnableHolePunching || spec.AsHub || len(spec.Endpoint) != 0 {
+		return false
+	}
+	return !peer.Spec.IsHub && len(peer.Spec.Endpoint) == 0
+}
+
+// punchEndpoint is the nat mapped endpoint of peer observed by hub, nil if hub has not seen it yet.
+func punchEndpoint(peer *v1alpha1.Peer) *net.UDPAddr {
+	if len(peer.Status.ObservedEndpoint) == 0 {
+		return nil
+	}
+	endpoint, err := net.ResolveUDPAddr("udp", peer.Status.ObservedEndpoint)
+	if err != nil {
+		klog.Infof("failed to parse observed endpoint %s of %s, never mind just ignore.",
+			peer.Status.ObservedEndpoint, peer.Name)
+		return nil
+	}
+	if endpoint.IP.IsLoopback() {
+		// peer talks to hub over fallback transport, there is no nat mapping to punch.
+		return nil
+	}
+	return endpoint
+}
@@ -0,0 +1,89 @@
+package tunnel
+
+import (
+	"testing"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+)
+
+func TestHolePunchingPeer(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		// endpoint is our own endpoint.
+		endpoint string
+		peer     v1alpha1.PeerSpec
+		want     bool
+	}{
+		{
+			name:    "private child clusters",
+			options: Options{EnableHolePunching: true},
+			want:    true,
+		},
+		{
+			name: "hole punching disabled",
+		},
+		{
+			name:    "we are hub",
+			options: Options{EnableHolePunching: true, AsHub: true},
+		},
+		{
+			name:     "we have endpoint",
+			options:  Options{EnableHolePunching: true},
+			endpoint: "1.1.1.1",
+		},
+		{
+			name:    "peer is hub",
+			options: Options{EnableHolePunching: true},
+			peer:    v1alpha1.PeerSpec{IsHub: true},
+		},
+		{
+			name:    "peer has endpoint",
+			options: Options{EnableHolePunching: true},
+			peer:    v1alpha1.PeerSpec{Endpoint: "2.2.2.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &Specification{Options: tt.options}
+			spec.Endpoint = tt.endpoint
+			if got := HolePunchingPeer(spec, &v1alpha1.Peer{Spec: tt.peer}); got != tt.want {
+				t.Errorf("HolePunchingPeer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPunchEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		observed string
+		want     string
+	}{
+		{
+			name: "not observed yet",
+		},
+		{
+			name:     "nat mapped endpoint",
+			observed: "3.3.3.3:41234",
+			want:     "3.3.3.3:41234",
+		},
+		{
+			name:     "invalid endpoint",
+			observed: "3.3.3.3",
+		},
+		{
+			name:     "over fallback transport",
+			observed: "127.0.0.1:41234",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := &v1alpha1.Peer{Status: v1alpha1.PeerStatus{ObservedEndpoint: tt.observed}}
+			got := punchEndpoint(peer)
+			if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+				t.Errorf("punchEndpoint() = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
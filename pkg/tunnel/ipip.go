@@ -0,0 +1,206 @@
+package tunnel
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/utils"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// inner cluster transports, inter cluster tunnels always use wire-guard.
+const (
+	TransportWireguard = "wireguard"
+	// TransportIPIP carries traffic between cnf pods in plain ip-in-ip, for trusted networks where
+	// encrypting the hop to the gateway costs more than it is worth.
+	TransportIPIP = "ipip"
+
+	// ipipOverhead is the outer ip header, ip-in-ip riding inside wire-guard leaves room for it.
+	ipipOverhead = 20
+)
+
+// SetIPIPLink creates a point to multipoint ip-in-ip device from local, remote end is given per route. The kernel
+// keeps one tunnel per local and remote address, one without local collides with the fallback tunl0. A device
+// from another local address is created again. Riding over wire-guard leaves room for the outer header in mtu.
+func SetIPIPLink(local string, overWireguard bool) error {
+	localIP := net.ParseIP(local)
+	if localIP == nil {
+		return errors.Errorf("invalid local ip '%s' of ip-in-ip device", local)
+	}
+	link, err := netlink.LinkByName(known.IPIPDeviceName)
+	if err != nil {
+		link = nil
+	} else if !ipipLinkFrom(link, localIP) {
+		klog.Infof("ip-in-ip device %s is not from %s, create it again", known.IPIPDeviceName, local)
+		if err = netlink.LinkDel(link); err != nil {
+			return errors.Wrap(err, "failed to delete ip-in-ip device")
+		}
+		link = nil
+	}
+	if link == nil {
+		la := netlink.NewLinkAttrs()
+		la.Name = known.IPIPDeviceName
+		if overWireguard {
+			wg, errWG := netlink.LinkByName(known.DefaultDeviceName)
+			if errWG != nil {
+				return errors.Wrapf(errWG, "cannot get wireguard link by name %s", known.DefaultDeviceName)
+			}
+			la.MTU = wg.Attrs().MTU - ipipOverhead
+		}
+		if err = netlink.LinkAdd(&netlink.Iptun{LinkAttrs: la, Local: localIP}); err != nil {
+			return errors.Wrap(err, "failed to add ip-in-ip device")
+		}
+		// the kernel fills in the index, routes need it.
+		if link, err = netlink.LinkByName(known.IPIPDeviceName); err != nil {
+			return errors.Wrap(err, "failed to get ip-in-ip device")
+		}
+	}
+	if link.Attrs().Flags&net.FlagUp != 0 {
+		return nil
+	}
+	if err = netlink.LinkSetUp(link); err != nil {
+		return errors.Wrap(err, "failed to bring up ip-in-ip device")
+	}
+	klog.Infof("ip-in-ip device %s is up from %s for inner cluster tunnels", known.IPIPDeviceName, local)
+	return nil
+}
+
+// ipipLinkFrom tells if link is an ip-in-ip device from local.
+func ipipLinkFrom(link netlink.Link, local net.IP) bool {
+	iptun, ok := link.(*netlink.Iptun)
+	return ok && iptun.Local.Equal(local)
+}
+
+func deleteIPIPLink() error {
+	if link, err := netlink.LinkByName(known.IPIPDeviceName); err == nil {
+		if err = netlink.LinkDel(link); err != nil {
+			return errors.Wrap(err, "failed to delete ip-in-ip device")
+		}
+	}
+	return nil
+}
+
+// InnerNextHop is where ip-in-ip packets to another cnf pod go: its eth0 ip in ip-in-ip transport, or its bridge ip
+// when multiple gateways share wire-guard transport, where ip-in-ip rides inside wire-guard. Only then traffic
+// from any source passes the source check of wire-guard, which allows one peer per address.
+func InnerNextHop(spec *Specification, config *DaemonCNFTunnelConfig) (string, error) {
+	if spec.InnerClusterTransport == TransportIPIP {
+		return config.EndpointIP(), nil
+	}
+	if len(config.SecondaryCIDR) == 0 {
+		return "", errors.Errorf("pod %s has no secondary cidr", config.PodID)
+	}
+	return utils.GetIndexIPFromCIDR(config.SecondaryCIDR[0], 1)
+}
+
+// ConfigBridgeRoute routes the bridge ip of another cnf pod through wire-guard, from our own bridge ip, so
+// ip-in-ip packets carry a source the other side allows for us.
+func ConfigBridgeRoute(bridgeIP, srcIP string, operation known.RouteOperation) error {
+	link, err := netlink.LinkByName(known.DefaultDeviceName)
+	if err != nil {
+		return errors.Wrapf(err, "%s not found in fleetboard", known.DefaultDeviceName)
+	}
+	dst := net.ParseIP(bridgeIP)
+	if dst == nil {
+		return errors.Errorf("invalid bridge ip '%s'", bridgeIP)
+	}
+	route := netlink.Route{
+		Dst:       &net.IPNet{IP: dst, Mask: net.CIDRMask(32, 32)},
+		Src:       net.ParseIP(srcIP),
+		LinkIndex: link.Attrs().Index,
+		Protocol:  4,
+		Scope:     unix.RT_SCOPE_LINK,
+	}
+	if operation == known.Add {
+		return netlink.RouteReplace(&route)
+	}
+	if err = netlink.RouteDel(&route); os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// ConfigMultipathRoute routes cidr through the ip-in-ip device over all the next hops, the kernel spreads flows
+// among them. No next hop removes the route.
+func ConfigMultipathRoute(cidr string, nextHops []string) error {
+	link, err := netlink.LinkByName(known.IPIPDeviceName)
+	if err != nil {
+		return errors.Wrapf(err, "%s not found in fleetboard", known.IPIPDeviceName)
+	}
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return errors.Wrapf(err, "can't parse cidr %s as route dst", cidr)
+	}
+	route := netlink.Route{
+		Dst:       dst,
+		LinkIndex: link.Attrs().Index,
+		Protocol:  4,
+		Scope:     unix.RT_SCOPE_UNIVERSE,
+	}
+	if len(nextHops) == 0 {
+		if err = netlink.RouteDel(&route); os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+			return nil
+		}
+		return err
+	}
+	for _, nextHop := range nextHops {
+		gw := net.ParseIP(nextHop)
+		if gw == nil {
+			return errors.Errorf("invalid next hop '%s'", nextHop)
+		}
+		route.MultiPath = append(route.MultiPath, &netlink.NexthopInfo{
+			LinkIndex: link.Attrs().Index,
+			Gw:        gw,
+			Flags:     int(netlink.FLAG_ONLINK),
+		})
+	}
+	return netlink.RouteReplace(&route)
+}
+
+// ConfigIPIPRoutes routes cidrs to remoteIP through the ip-in-ip device.
+func ConfigIPIPRoutes(cidrs []string, remoteIP string, operation known.RouteOperation) error {
+	klog.Infof("prepare to %v ip-in-ip route with %s via %s", operation, cidrs, remoteIP)
+	link, err := netlink.LinkByName(known.IPIPDeviceName)
+	if err != nil {
+		return errors.Wrapf(err, "%s not found in fleetboard", known.IPIPDeviceName)
+	}
+	// a deleted pod may have lost its ip, route is found by dst when deleting.
+	gw := net.ParseIP(remoteIP)
+	if gw == nil && operation == known.Add {
+		return errors.Errorf("invalid remote ip '%s'", remoteIP)
+	}
+
+	for _, cidr := range cidrs {
+		_, dst, err := net.ParseCIDR(cidr)
+		if err != nil {
+			klog.Errorf("Can't parse cidr %s as route dst", cidr)
+			return err
+		}
+		route := netlink.Route{
+			Dst:       dst,
+			Gw:        gw,
+			LinkIndex: link.Attrs().Index,
+			Protocol:  4,
+			Flags:     int(netlink.FLAG_ONLINK),
+			Scope:     unix.RT_SCOPE_UNIVERSE,
+		}
+		if operation == known.Add {
+			// replace, the remote pod may come back with another ip.
+			err = netlink.RouteReplace(&route)
+		} else {
+			err = netlink.RouteDel(&route)
+			if os.IsNotExist(err) || errors.Is(err, unix.ESRCH) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package tunnel
+
+import (
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+func TestSetIPIPLink(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skipf("can't get network namespace: %v", err)
+	}
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("can't create network namespace: %v", err)
+	}
+	defer func() {
+		_ = netns.Set(origin)
+		ns.Close()
+	}()
+	// the fallback tunl0 is there once the ipip module is loaded, add one to be sure.
+	if err = netlink.LinkAdd(&netlink.Iptun{LinkAttrs: netlink.LinkAttrs{Name: "tunl-any"}}); err != nil {
+		t.Skipf("can't add ip-in-ip device: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		local        string
+		wantErr      bool
+		wantRecreate bool
+	}{
+		{name: "created beside a tunnel without local", local: "10.0.0.1", wantRecreate: true},
+		{name: "kept from the same local", local: "10.0.0.1"},
+		{name: "created again from another local", local: "10.0.0.2", wantRecreate: true},
+		{name: "invalid local", local: "10.0.0", wantErr: true},
+	}
+	lastIndex := 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetIPIPLink(tt.local, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetIPIPLink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			link, err := netlink.LinkByName(known.IPIPDeviceName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ipipLinkFrom(link, net.ParseIP(tt.local)) || link.Attrs().Flags&net.FlagUp == 0 {
+				t.Errorf("ip-in-ip device = %+v, want up from %s", link, tt.local)
+			}
+			if recreated := link.Attrs().Index != lastIndex; recreated != tt.wantRecreate {
+				t.Errorf("device created again = %v, want %v", recreated, tt.wantRecreate)
+			}
+			lastIndex = link.Attrs().Index
+		})
+	}
+}
+
+func TestIPIPLinkFrom(t *testing.T) {
+	local := net.ParseIP("10.0.0.1")
+	tests := []struct {
+		name string
+		link netlink.Link
+		want bool
+	}{
+		{name: "same local", link: &netlink.Iptun{Local: net.ParseIP("10.0.0.1").To4()}, want: true},
+		{name: "another local", link: &netlink.Iptun{Local: net.ParseIP("10.0.0.2")}},
+		{name: "fallback without local", link: &netlink.Iptun{Local: net.IPv4zero}},
+		{name: "not ip-in-ip", link: &netlink.Dummy{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipipLinkFrom(tt.link, local); got != tt.want {
+				t.Errorf("ipipLinkFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
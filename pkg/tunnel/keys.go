@@ -0,0 +1,136 @@
+package tunnel
+
+import (
+	"context"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+)
+
+// keyRecord is what we keep in the key secret of a node.
+type keyRecord struct {
+	privateKey wgtypes.Key
+	// previousKey is only set during a rotation, it is kept until remote peers have picked up privateKey.
+	previousKey *wgtypes.Key
+	rotatedAt   time.Time
+	// nextKey is published ahead of a rotation, privateKey is still in use until the device switches to it.
+	nextKey  *wgtypes.Key
+	stagedAt time.Time
+}
+
+// keySecretName is per node rather than per cluster, every cnf pod owns a wg device and inner cluster
+// tunnels between them need different keys.
+func keySecretName(nodeName string) string {
+	return known.WireguardKeySecretPrefix + nodeName
+}
+
+// loadOrCreateKeyRecord returns the keys stored for this node, a new private key is generated and stored
+// if there is none yet.
+func loadOrCreateKeyRecord(k8sClient kubernetes.Interface, nodeName string) (*keyRecord, error) {
+	if len(nodeName) != 0 {
+		record, err := loadKeyRecord(k8sClient, nodeName)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			klog.Infof("reuse wireguard private key stored in secret %s", keySecretName(nodeName))
+			return record, nil
+		}
+	}
+
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating private key")
+	}
+	record := &keyRecord{privateKey: key, rotatedAt: time.Now()}
+	if err = storeKeyRecord(k8sClient, nodeName, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func loadKeyRecord(k8sClient kubernetes.Interface, nodeName string) (*keyRecord, error) {
+	name := keySecretName(nodeName)
+	secret, err := k8sClient.CoreV1().Secrets(known.FleetboardSystemNamespace).
+		Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get secret %s", name)
+	}
+
+	key, err := wgtypes.NewKey(secret.Data[known.WireguardPrivateKey])
+	if err != nil {
+		klog.Warningf("invalid private key in secret %s, generating a new one", name)
+		return nil, nil
+	}
+	record := &keyRecord{privateKey: key, rotatedAt: secret.CreationTimestamp.Time}
+	if rotatedAt, errParse := time.Parse(time.RFC3339, secret.Annotations[known.WireguardKeyRotatedAt]); errParse == nil {
+		record.rotatedAt = rotatedAt
+	}
+	if previousKey, errParse := wgtypes.NewKey(secret.Data[known.WireguardPreviousPrivateKey]); errParse == nil {
+		record.previousKey = &previousKey
+	}
+	if nextKey, errParse := wgtypes.NewKey(secret.Data[known.WireguardNextPrivateKey]); errParse == nil {
+		record.nextKey = &nextKey
+		record.stagedAt = record.rotatedAt
+		stagedAt, errParse := time.Parse(time.RFC3339, secret.Annotations[known.WireguardKeyStagedAt])
+		if errParse == nil {
+			record.stagedAt = stagedAt
+		}
+	}
+	return record, nil
+}
+
+// storeKeyRecord creates or overwrites the key secret of this node.
+func storeKeyRecord(k8sClient kubernetes.Interface, nodeName string, record *keyRecord) error {
+	if len(nodeName) == 0 {
+		klog.Warningf("node name is empty, wireguard private key will not survive restart")
+		return nil
+	}
+
+	name := keySecretName(nodeName)
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: known.FleetboardSystemNamespace,
+			Labels: map[string]string{
+				known.ObjectCreatedByLabel: known.Fleetboard,
+			},
+			Annotations: map[string]string{
+				known.WireguardKeyRotatedAt: record.rotatedAt.UTC().Format(time.RFC3339),
+			},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			known.WireguardPrivateKey: record.privateKey[:],
+		},
+	}
+	if record.previousKey != nil {
+		secret.Data[known.WireguardPreviousPrivateKey] = record.previousKey[:]
+	}
+	if record.nextKey != nil {
+		secret.Data[known.WireguardNextPrivateKey] = record.nextKey[:]
+		secret.Annotations[known.WireguardKeyStagedAt] = record.stagedAt.UTC().Format(time.RFC3339)
+	}
+
+	_, err := k8sClient.CoreV1().Secrets(known.FleetboardSystemNamespace).
+		Create(context.TODO(), secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = k8sClient.CoreV1().Secrets(known.FleetboardSystemNamespace).
+			Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to store private key in secret %s", name)
+	}
+	return nil
+}
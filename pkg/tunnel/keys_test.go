@@ -0,0 +1,117 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+func TestLoadOrCreateKeyRecord(t *testing.T) {
+	key, previousKey, nextKey := newTestKey(t), newTestKey(t), newTestKey(t)
+	rotatedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	stagedAt := rotatedAt.Add(time.Minute)
+	secret := func(data map[string][]byte, annotations map[string]string) *v1.Secret {
+		return &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: keySecretName("node-1"), Namespace: known.FleetboardSystemNamespace,
+				Annotations: annotations},
+			Data: data,
+		}
+	}
+	tests := []struct {
+		name     string
+		nodeName string
+		objects  []runtime.Object
+		// wantKey is nil if a new key is expected.
+		wantKey      *wgtypes.Key
+		wantPrevious *wgtypes.Key
+		wantNext     *wgtypes.Key
+		wantStored   bool
+	}{
+		{
+			name:       "created and stored",
+			nodeName:   "node-1",
+			wantStored: true,
+		},
+		{
+			name:     "reused after restart",
+			nodeName: "node-1",
+			objects: []runtime.Object{secret(map[string][]byte{known.WireguardPrivateKey: key[:]},
+				map[string]string{known.WireguardKeyRotatedAt: rotatedAt.Format(time.RFC3339)})},
+			wantKey:    &key,
+			wantStored: true,
+		},
+		{
+			name:     "keys of rotation in progress",
+			nodeName: "node-1",
+			objects: []runtime.Object{secret(map[string][]byte{
+				known.WireguardPrivateKey:         key[:],
+				known.WireguardPreviousPrivateKey: previousKey[:],
+				known.WireguardNextPrivateKey:     nextKey[:],
+			}, map[string]string{
+				known.WireguardKeyRotatedAt: rotatedAt.Format(time.RFC3339),
+				known.WireguardKeyStagedAt:  stagedAt.Format(time.RFC3339),
+			})},
+			wantKey:      &key,
+			wantPrevious: &previousKey,
+			wantNext:     &nextKey,
+			wantStored:   true,
+		},
+		{
+			name:       "invalid key is replaced",
+			nodeName:   "node-1",
+			objects:    []runtime.Object{secret(map[string][]byte{known.WireguardPrivateKey: []byte("short")}, nil)},
+			wantStored: true,
+		},
+		{
+			name: "not stored without node name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sClient := fake.NewSimpleClientset(tt.objects...)
+			record, err := loadOrCreateKeyRecord(k8sClient, tt.nodeName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantKey != nil && record.privateKey != *tt.wantKey {
+				t.Errorf("private key = %s, want %s", record.privateKey.PublicKey(), tt.wantKey.PublicKey())
+			}
+			if tt.wantKey != nil && !record.rotatedAt.Equal(rotatedAt) {
+				t.Errorf("rotatedAt = %s, want %s", record.rotatedAt, rotatedAt)
+			}
+			if !sameKey(record.previousKey, tt.wantPrevious) || !sameKey(record.nextKey, tt.wantNext) {
+				t.Errorf("previous key %v and next key %v, want %v and %v", record.previousKey, record.nextKey,
+					tt.wantPrevious, tt.wantNext)
+			}
+			if tt.wantNext != nil && !record.stagedAt.Equal(stagedAt) {
+				t.Errorf("stagedAt = %s, want %s", record.stagedAt, stagedAt)
+			}
+
+			stored, err := k8sClient.CoreV1().Secrets(known.FleetboardSystemNamespace).
+				Get(context.TODO(), keySecretName(tt.nodeName), metav1.GetOptions{})
+			if (err == nil) != tt.wantStored {
+				t.Fatalf("stored = %v, want %v", err == nil, tt.wantStored)
+			}
+			if tt.wantStored {
+				if storedKey, _ := wgtypes.NewKey(stored.Data[known.WireguardPrivateKey]); storedKey != record.privateKey {
+					t.Errorf("stored key %s, want %s", storedKey.PublicKey(), record.privateKey.PublicKey())
+				}
+			}
+		})
+	}
+}
+
+func sameKey(a, b *wgtypes.Key) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
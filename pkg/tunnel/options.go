@@ -2,7 +2,10 @@ package tunnel
 
 import (
 	"fmt"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/config"
 	"k8s.io/component-base/logs"
@@ -31,6 +34,41 @@ type Options struct {
 	CIDR string
 	// hub url is the service url for hub cluster api-server
 	HubURL string
+	// KeyRotationInterval means how often wire-guard keys are rotated, 0 means never.
+	KeyRotationInterval time.Duration
+	// TunnelDriver is how the wire-guard device is implemented, kernel or userspace.
+	TunnelDriver string
+	// InnerClusterTransport is how cnf pods in one cluster talk to the leader, wireguard or ipip.
+	InnerClusterTransport string
+	// EnablePresharedKey means every peer pair adds a pre-shared key on top of curve25519.
+	EnablePresharedKey bool
+	// EnableHolePunching means child clusters without public ip try direct tunnels with each other.
+	EnableHolePunching bool
+	// FallbackTransport is served for peers whose udp is blocked, tcp or wss, empty means disabled.
+	FallbackTransport string
+	// FallbackPort is where the fallback transport listens.
+	FallbackPort int
+	// FallbackTimeout is how long to wait for a handshake before switching between udp and fallback.
+	FallbackTimeout time.Duration
+	// GatewayServiceType exposes the leader through a service of this type, LoadBalancer or NodePort,
+	// its address replaces the endpoint. Empty means disabled.
+	GatewayServiceType string
+	// GatewayNodes names nodes whose cnf pod may become leader, it takes precedence over GatewayNodeSelector.
+	GatewayNodes []string
+	// GatewayNodeSelector selects nodes whose cnf pod may become leader, master and control plane if both empty.
+	GatewayNodeSelector string
+	// GatewayCandidateFallback lets any node run for leader when no cnf pod runs on a candidate node.
+	GatewayCandidateFallback bool
+	// GatewayReplicas is how many cnf pods carry inter cluster traffic at the same time, the leader included.
+	GatewayReplicas int
+	// MetricsBindAddress is where metrics are served, empty means disabled.
+	MetricsBindAddress string
+	// HealthProbeBindAddress is where /healthz and /readyz are served, empty means disabled.
+	HealthProbeBindAddress string
+	// Cleanup removes devices, routes and dedicated nics cnf leaves behind, then exits.
+	Cleanup bool
+	// CleanupPeer deletes the peer of this cluster in hub during cleanup, which releases its cidr.
+	CleanupPeer bool
 
 	Logs *logs.Options
 	// ClientConnection specifies the kubeconfig file and client connection
@@ -41,8 +79,16 @@ type Options struct {
 // NewOptions creates a new Options object with default parameters
 func NewOptions() *Options {
 	o := Options{
-		ClientConnection: config.ClientConnectionConfiguration{},
-		Logs:             logs.NewOptions(),
+		TunnelDriver:             DriverKernel,
+		InnerClusterTransport:    TransportWireguard,
+		FallbackPort:             known.FallbackPort,
+		FallbackTimeout:          time.Minute,
+		GatewayCandidateFallback: true,
+		GatewayReplicas:          1,
+		MetricsBindAddress:       ":8080",
+		HealthProbeBindAddress:   ":8081",
+		ClientConnection:         config.ClientConnectionConfiguration{},
+		Logs:                     logs.NewOptions(),
 	}
 	o.Logs.Verbosity = logsapi.VerbosityLevel(2)
 
@@ -70,6 +116,56 @@ func (o *Options) Validate() []error {
 		allErrors = append(allErrors, fmt.Errorf("--hub-secret-name must be specified when run as cluser"))
 	}
 
+	if o.TunnelDriver != DriverKernel && o.TunnelDriver != DriverUserspace {
+		allErrors = append(allErrors, fmt.Errorf("--tunnel-driver must be %s or %s", DriverKernel,
+			DriverUserspace))
+	}
+
+	if o.InnerClusterTransport != TransportWireguard && o.InnerClusterTransport != TransportIPIP {
+		allErrors = append(allErrors, fmt.Errorf("--inner-cluster-transport must be %s or %s",
+			TransportWireguard, TransportIPIP))
+	}
+
+	if len(o.FallbackTransport) != 0 && o.FallbackTransport != FallbackTCP && o.FallbackTransport != FallbackWSS {
+		allErrors = append(allErrors, fmt.Errorf("--fallback-transport must be empty, %s or %s", FallbackTCP,
+			FallbackWSS))
+	}
+
+	if len(o.GatewayServiceType) != 0 && o.GatewayServiceType != string(v1.ServiceTypeLoadBalancer) &&
+		o.GatewayServiceType != string(v1.ServiceTypeNodePort) {
+		allErrors = append(allErrors, fmt.Errorf("--gateway-service-type must be empty, %s or %s",
+			v1.ServiceTypeLoadBalancer, v1.ServiceTypeNodePort))
+	}
+
+	if len(o.GatewayServiceType) != 0 && o.EnableHolePunching {
+		// the service publishes an endpoint, there is no nat to punch.
+		allErrors = append(allErrors, fmt.Errorf("--enable-hole-punching doesn't work with --gateway-service-type"))
+	}
+
+	if o.GatewayReplicas < 1 {
+		allErrors = append(allErrors, fmt.Errorf("--gateway-replicas must be at least 1"))
+	}
+	if o.GatewayReplicas > 1 && !o.AsCluster {
+		allErrors = append(allErrors, fmt.Errorf("--gateway-replicas only works with --as-cluster"))
+	}
+	if o.GatewayReplicas > 1 && len(o.GatewayServiceType) != 0 {
+		// the service only exposes the leader, additional gateways would be published at their nodes.
+		allErrors = append(allErrors, fmt.Errorf("--gateway-replicas doesn't work with --gateway-service-type"))
+	}
+
+	if _, err := labels.Parse(o.GatewayNodeSelector); err != nil {
+		allErrors = append(allErrors, fmt.Errorf("--gateway-node-selector is invalid: %v", err))
+	}
+
+	if o.CleanupPeer && !o.Cleanup {
+		allErrors = append(allErrors, fmt.Errorf("--cleanup-peer only works with --cleanup"))
+	}
+
+	if o.KeyRotationInterval != 0 && o.KeyRotationInterval < 2*KeyRotationGracePeriod {
+		allErrors = append(allErrors, fmt.Errorf("--key-rotation-interval must be 0 or at least %s",
+			2*KeyRotationGracePeriod))
+	}
+
 	return allErrors
 }
 
@@ -108,5 +204,67 @@ func (o *Options) Flags() (fss cliflag.NamedFlagSets) {
 	fs.StringVar(&o.ShareNamespace, "shared-namespace", o.ShareNamespace,
 		"shared namespace in hub used to share endpoint slices across clusters")
 
+	fs.DurationVar(&o.KeyRotationInterval, "key-rotation-interval", o.KeyRotationInterval,
+		"how often wireguard keys are rotated, 0 means never rotate. [default=0]")
+
+	fs.StringVar(&o.TunnelDriver, "tunnel-driver", o.TunnelDriver, "how wireguard device is implemented, "+
+		"kernel or userspace, userspace is for nodes without wireguard kernel module. [default=kernel]")
+
+	fs.StringVar(&o.InnerClusterTransport, "inner-cluster-transport", o.InnerClusterTransport,
+		"how cnf pods in one cluster reach the leader, wireguard or ipip. ipip is unencrypted and only for "+
+			"trusted networks allowing ip protocol 4. [default=wireguard]")
+
+	fs.BoolVar(&o.EnablePresharedKey, "enable-preshared-key", false, "If true, use a pre-shared key for "+
+		"every tunnel, a pair of clusters uses it once both sides enable it. [default=false]")
+
+	fs.BoolVar(&o.EnableHolePunching, "enable-hole-punching", false, "If true, child clusters without public "+
+		"ip try direct tunnels with each other through nat hole punching, hub path is used until the direct "+
+		"path handshakes. [default=false]")
+
+	fs.StringVar(&o.FallbackTransport, "fallback-transport", o.FallbackTransport, "serve wireguard over tcp "+
+		"or wss for peers behind firewalls dropping udp, empty means disabled. Peers switch to it when no "+
+		"handshake completes in --fallback-timeout. [default=\"\"]")
+
+	fs.IntVar(&o.FallbackPort, "fallback-port", o.FallbackPort, "port of the fallback transport.")
+
+	fs.DurationVar(&o.FallbackTimeout, "fallback-timeout", o.FallbackTimeout, "how long to wait for a "+
+		"handshake before switching a peer between udp and its fallback transport. [default=1m]")
+
+	fs.StringVar(&o.GatewayServiceType, "gateway-service-type", o.GatewayServiceType, "expose the cnf leader "+
+		"through a LoadBalancer or NodePort service and publish its address instead of the endpoint, empty "+
+		"means disabled. [default=\"\"]")
+
+	fs.StringSliceVar(&o.GatewayNodes, "gateway-nodes", o.GatewayNodes, "names of nodes whose cnf pod may "+
+		"become leader, takes precedence over --gateway-node-selector.")
+
+	fs.StringVar(&o.GatewayNodeSelector, "gateway-node-selector", o.GatewayNodeSelector, "label selector of "+
+		"nodes whose cnf pod may become leader, master and control plane nodes if empty.")
+
+	fs.BoolVar(&o.GatewayCandidateFallback, "gateway-candidate-fallback", o.GatewayCandidateFallback, "If true, "+
+		"any node runs for leader when no cnf pod runs on a gateway candidate node, e.g. managed kubernetes "+
+		"without control plane nodes. [default=true]")
+
+	fs.IntVar(&o.GatewayReplicas, "gateway-replicas", o.GatewayReplicas, "how many cnf pods on gateway "+
+		"candidate nodes carry inter cluster traffic at the same time, other cnf pods spread traffic over them "+
+		"with ecmp routes. [default=1]")
+
+	fs.StringVar(&o.MetricsBindAddress, "metrics-bind-address", o.MetricsBindAddress, "the address metrics are "+
+		"served on at /metrics, empty means disabled. [default=:8080]")
+
+	fs.StringVar(&o.HealthProbeBindAddress, "health-probe-bind-address", o.HealthProbeBindAddress, "the address "+
+		"/healthz and /readyz are served on, empty means disabled. [default=:8081]")
+
+	fs.BoolVar(&o.Cleanup, "cleanup", false, "If true, remove wireguard and ip-in-ip devices, the fleetboard "+
+		"bridge and dedicated nics of pods with their routes and ips, then exit. [default=false]")
+
+	fs.BoolVar(&o.CleanupPeer, "cleanup-peer", false, "If true, --cleanup also deletes the peer of this cluster "+
+		"in hub, which releases its cidr. Only for uninstalling, other clusters lose their tunnels to it. "+
+		"[default=false]")
+
 	return fss
 }
+
+// MultiGateway tells if more than the leader carries inter cluster traffic.
+func (o *Options) MultiGateway() bool {
+	return o.GatewayReplicas > 1
+}
@@ -0,0 +1,107 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+)
+
+// presharedKeySecretName is the same for both sides, so they meet at one secret.
+func presharedKeySecretName(localID, remoteID string) string {
+	return known.PresharedKeySecretPrefix + sortedPair(localID, remoteID)
+}
+
+func sortedPair(localID, remoteID string) string {
+	pair := []string{localID, remoteID}
+	sort.Strings(pair)
+	return strings.Join(pair, "-")
+}
+
+// GetOrCreatePresharedKey returns the pre-shared key of two cnf pods stored in namespace of local cluster,
+// whichever side comes first generates it.
+func GetOrCreatePresharedKey(client kubernetes.Interface, namespace, localID, remoteID string) (*wgtypes.Key,
+	error) {
+	return getOrCreateKeySecret(client, namespace, presharedKeySecretName(localID, remoteID),
+		known.WireguardPresharedKey, map[string]string{
+			known.PresharedKeyPair: strings.Join([]string{localID, remoteID}, ","),
+		}, wgtypes.GenerateKey)
+}
+
+// LoadOrCreateExchangeKey returns the key this cluster derives pre-shared keys with other clusters from, all
+// cnf pods of the cluster share it. It's kept in local cluster, only its public key leaves the cluster.
+func LoadOrCreateExchangeKey(client kubernetes.Interface) (*wgtypes.Key, error) {
+	return getOrCreateKeySecret(client, known.FleetboardSystemNamespace, known.PresharedKeyExchangeSecret,
+		known.WireguardExchangeKey, nil, wgtypes.GeneratePrivateKey)
+}
+
+// DerivePresharedKey derives the pre-shared key of two clusters from our exchange key and the exchange public key
+// of the other side, both sides come to the same key and clusters sharing hub can't compute it.
+func DerivePresharedKey(exchangeKey wgtypes.Key, remoteExchangeKey, localID, remoteID string) (*wgtypes.Key,
+	error) {
+	remoteKey, err := wgtypes.ParseKey(remoteExchangeKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse exchange key of %s", remoteID)
+	}
+	shared, err := curve25519.X25519(exchangeKey[:], remoteKey[:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to exchange key with %s", remoteID)
+	}
+	var psk wgtypes.Key
+	kdf := hkdf.New(sha256.New, shared, nil, []byte(presharedKeySecretName(localID, remoteID)))
+	if _, err = io.ReadFull(kdf, psk[:]); err != nil {
+		return nil, errors.Wrapf(err, "failed to derive pre-shared key with %s", remoteID)
+	}
+	return &psk, nil
+}
+
+// getOrCreateKeySecret returns the key stored in secret namespace/name, it's generated if there is none yet.
+func getOrCreateKeySecret(client kubernetes.Interface, namespace, name, dataKey string,
+	annotations map[string]string, generate func() (wgtypes.Key, error)) (*wgtypes.Key, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		key, errGenerate := generate()
+		if errGenerate != nil {
+			return nil, errors.Wrapf(errGenerate, "error generating key of secret %s/%s", namespace, name)
+		}
+		secret, err = client.CoreV1().Secrets(namespace).Create(context.TODO(), &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					known.ObjectCreatedByLabel: known.Fleetboard,
+				},
+				Annotations: annotations,
+			},
+			Type: v1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				dataKey: key[:],
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// the other side is faster.
+			secret, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get key secret %s/%s", namespace, name)
+	}
+
+	key, err := wgtypes.NewKey(secret.Data[dataKey])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid key in secret %s/%s", namespace, name)
+	}
+	return &key, nil
+}
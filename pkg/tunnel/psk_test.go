@@ -0,0 +1,50 @@
+package tunnel
+
+import (
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestDerivePresharedKey(t *testing.T) {
+	keyA, keyB, keyC := newTestKey(t), newTestKey(t), newTestKey(t)
+	derive := func(local, remote wgtypes.Key, localID, remoteID string) wgtypes.Key {
+		psk, err := DerivePresharedKey(local, remote.PublicKey().String(), localID, remoteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *psk
+	}
+	tests := []struct {
+		name      string
+		got, want wgtypes.Key
+		same      bool
+	}{
+		{
+			name: "both sides of a pair",
+			got:  derive(keyA, keyB, "cluster-a", "cluster-b"),
+			want: derive(keyB, keyA, "cluster-b", "cluster-a"),
+			same: true,
+		},
+		{
+			name: "another pair",
+			got:  derive(keyA, keyB, "cluster-a", "cluster-b"),
+			want: derive(keyA, keyC, "cluster-a", "cluster-c"),
+		},
+		{
+			name: "exchange keys reused under other cluster ids",
+			got:  derive(keyA, keyB, "cluster-a", "cluster-b"),
+			want: derive(keyA, keyB, "cluster-a", "cluster-d"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.got == tt.want) != tt.same {
+				t.Errorf("keys are the same: %v, want %v", tt.got == tt.want, tt.same)
+			}
+		})
+	}
+	if _, err := DerivePresharedKey(keyA, "invalid", "cluster-a", "cluster-b"); err == nil {
+		t.Errorf("DerivePresharedKey() with invalid exchange key succeeds")
+	}
+}
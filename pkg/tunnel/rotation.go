@@ -0,0 +1,219 @@
+package tunnel
+
+import (
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/fleetboard-io/fleetboard/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeyRotationGracePeriod is how long remote peers have to pick up a new key before we roll back.
+	KeyRotationGracePeriod = 5 * time.Minute
+	// KeyPickupPeriod is how long the next key is published before the device switches to it, remote peers add
+	// it to their devices meanwhile, so the tunnel is up with the new key as soon as we switch.
+	KeyPickupPeriod = time.Minute
+	// peers handshaked within this period are taken as alive when rotation starts.
+	aliveHandshakePeriod = 3 * time.Minute
+)
+
+// KeyRotationDue returns true if current key is older than interval and no rotation is in progress.
+func (w *Wireguard) KeyRotationDue(interval time.Duration, now time.Time) bool {
+	w.Lock()
+	defer w.Unlock()
+	return interval > 0 && w.Keys.previousKey == nil && w.Keys.nextKey == nil &&
+		now.Sub(w.Keys.rotatedAt) >= interval
+}
+
+// NextPublicKey is the public key published ahead of a rotation, empty if no rotation is in progress.
+func (w *Wireguard) NextPublicKey() string {
+	w.Lock()
+	defer w.Unlock()
+	if w.Keys.nextKey == nil {
+		return ""
+	}
+	return w.Keys.nextKey.PublicKey().String()
+}
+
+// RotateKey starts a rotation by publishing a next key on pod annotation, the device keeps the current key.
+// Remote peers add the next key as a standby peer, ConfirmKeyRotation switches the device to it after
+// KeyPickupPeriod.
+func (w *Wireguard) RotateKey(k8sClient kubernetes.Interface) error {
+	nextKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return errors.Wrap(err, "error generating private key")
+	}
+	now := time.Now()
+
+	w.Lock()
+	record := &keyRecord{privateKey: w.Keys.privateKey, rotatedAt: w.Keys.rotatedAt, nextKey: &nextKey,
+		stagedAt: now}
+	w.Unlock()
+	// store it first, so a crash never loses a key remote peers may have picked up.
+	if err = storeKeyRecord(k8sClient, w.Spec.NodeName, record); err != nil {
+		return err
+	}
+	w.Lock()
+	w.Keys.nextKey = &nextKey
+	w.Keys.stagedAt = now
+	w.Unlock()
+
+	klog.Infof("wireguard key rotation started, next key %s is published", nextKey.PublicKey())
+	return utils.AddAnnotationToSelf(k8sClient, known.NextPublicKey, nextKey.PublicKey().String(), true)
+}
+
+// ConfirmKeyRotation moves a rotation in progress forward. After KeyPickupPeriod the device switches to the
+// next key, then the previous key is retired once all peers alive at the switch have handshaked with the new
+// key. If they don't within gracePeriod, the previous key is restored. published is true if the public key of
+// the device has changed and needs publishing.
+func (w *Wireguard) ConfirmKeyRotation(k8sClient kubernetes.Interface, gracePeriod time.Duration) (
+	published bool, err error) {
+	w.Lock()
+	staged := w.Keys.nextKey != nil
+	pickedUp := staged && time.Since(w.Keys.stagedAt) >= KeyPickupPeriod
+	rotating := w.Keys.previousKey != nil
+	w.Unlock()
+	switch {
+	case pickedUp:
+		return w.switchToNextKey(k8sClient)
+	case staged || !rotating:
+		return false, nil
+	}
+
+	record, rolledBack, err := w.retireOrRollBack(gracePeriod)
+	if err != nil || record == nil {
+		return false, err
+	}
+	if err = storeKeyRecord(k8sClient, w.Spec.NodeName, record); err != nil {
+		return false, err
+	}
+	w.Lock()
+	if rolledBack {
+		if err = w.setPrivateKey(record.privateKey); err != nil {
+			w.Unlock()
+			return false, err
+		}
+	} else {
+		klog.Infof("all peers picked up wireguard key %s, retire the previous one", w.Keys.PublicKey)
+	}
+	w.Keys.previousKey = nil
+	w.Keys.pendingPeers = nil
+	w.Keys.rotatedAt = record.rotatedAt
+	publicKey := w.Keys.PublicKey
+	w.Unlock()
+	if !rolledBack {
+		return false, nil
+	}
+	return true, utils.AddAnnotationToSelf(k8sClient, known.PublicKey, publicKey.String(), true)
+}
+
+// switchToNextKey switches the device to the next key, the current one is kept to roll back to. switched is
+// true once the device uses the next key.
+func (w *Wireguard) switchToNextKey(k8sClient kubernetes.Interface) (switched bool, err error) {
+	now := time.Now()
+	w.Lock()
+	pendingPeers, err := w.alivePeers(now)
+	currentKey, nextKey := w.Keys.privateKey, *w.Keys.nextKey
+	w.Unlock()
+	if err != nil {
+		return false, err
+	}
+	// store it first, so a crash after switching the device never loses the key in use.
+	record := &keyRecord{privateKey: nextKey, previousKey: &currentKey, rotatedAt: now}
+	if err = storeKeyRecord(k8sClient, w.Spec.NodeName, record); err != nil {
+		return false, err
+	}
+
+	w.Lock()
+	if err = w.setPrivateKey(nextKey); err != nil {
+		w.Unlock()
+		return false, err
+	}
+	w.Keys.previousKey = &currentKey
+	w.Keys.rotatedAt = now
+	w.Keys.pendingPeers = pendingPeers
+	w.Keys.nextKey = nil
+	w.Unlock()
+
+	klog.Infof("wireguard key rotated to %s, waiting for %d peers to pick it up", nextKey.PublicKey(),
+		len(pendingPeers))
+	if err = utils.AddAnnotationToSelf(k8sClient, known.PublicKey, nextKey.PublicKey().String(), true); err != nil {
+		return true, err
+	}
+	return true, utils.AddAnnotationToSelf(k8sClient, known.NextPublicKey, "", true)
+}
+
+// retireOrRollBack decides the key record once remote peers have handshaked with the new key, or gracePeriod is
+// over. record is nil if it's still waiting for peers.
+func (w *Wireguard) retireOrRollBack(gracePeriod time.Duration) (record *keyRecord, rolledBack bool, err error) {
+	w.Lock()
+	defer w.Unlock()
+	d, err := w.client.Device(known.DefaultDeviceName)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "wgctrl cannot find WireGuard device")
+	}
+	for _, peer := range d.Peers {
+		if peer.LastHandshakeTime.After(w.Keys.rotatedAt) {
+			delete(w.Keys.pendingPeers, peer.PublicKey.String())
+		}
+	}
+	// peers removed from device meanwhile will never handshake, don't wait for them.
+	for key := range w.Keys.pendingPeers {
+		if !deviceHasPeer(d.Peers, key) {
+			delete(w.Keys.pendingPeers, key)
+		}
+	}
+
+	if len(w.Keys.pendingPeers) == 0 {
+		return &keyRecord{privateKey: w.Keys.privateKey, rotatedAt: w.Keys.rotatedAt}, false, nil
+	}
+	if time.Since(w.Keys.rotatedAt) < gracePeriod {
+		return nil, false, nil
+	}
+	klog.Warningf("%d peers didn't pick up new wireguard key in %s, roll back", len(w.Keys.pendingPeers),
+		gracePeriod)
+	// try again after a whole interval.
+	return &keyRecord{privateKey: *w.Keys.previousKey, rotatedAt: time.Now()}, true, nil
+}
+
+// setPrivateKey configures device with key and keeps existing peers, caller must hold the lock.
+func (w *Wireguard) setPrivateKey(key wgtypes.Key) error {
+	if err := w.client.ConfigureDevice(known.DefaultDeviceName, wgtypes.Config{
+		PrivateKey:   &key,
+		ReplacePeers: false,
+	}); err != nil {
+		return errors.Wrap(err, "failed to set WireGuard private key")
+	}
+	w.Keys.privateKey = key
+	w.Keys.PublicKey = key.PublicKey()
+	return nil
+}
+
+// alivePeers returns public keys of peers handshaked recently, caller must hold the lock.
+func (w *Wireguard) alivePeers(now time.Time) (map[string]struct{}, error) {
+	d, err := w.client.Device(known.DefaultDeviceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "wgctrl cannot find WireGuard device")
+	}
+	peers := make(map[string]struct{})
+	for _, peer := range d.Peers {
+		if !peer.LastHandshakeTime.IsZero() && now.Sub(peer.LastHandshakeTime) < aliveHandshakePeriod {
+			peers[peer.PublicKey.String()] = struct{}{}
+		}
+	}
+	return peers, nil
+}
+
+func deviceHasPeer(peers []wgtypes.Peer, key string) bool {
+	for _, peer := range peers {
+		if peer.PublicKey.String() == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+)
+
+// fakeClient is a wire-guard device in memory, configs are applied the way the kernel does.
+type fakeClient struct {
+	device wgtypes.Device
+}
+
+func (f *fakeClient) Device(_ string) (*wgtypes.Device, error) {
+	d := f.device
+	d.Peers = append([]wgtypes.Peer(nil), f.device.Peers...)
+	return &d, nil
+}
+
+func (f *fakeClient) ConfigureDevice(_ string, cfg wgtypes.Config) error {
+	if cfg.PrivateKey != nil {
+		f.device.PrivateKey = *cfg.PrivateKey
+		f.device.PublicKey = cfg.PrivateKey.PublicKey()
+	}
+	if cfg.ReplacePeers {
+		f.device.Peers = nil
+	}
+	for _, peerCfg := range cfg.Peers {
+		index := -1
+		for i := range f.device.Peers {
+			if f.device.Peers[i].PublicKey == peerCfg.PublicKey {
+				index = i
+			}
+		}
+		switch {
+		case peerCfg.Remove:
+			if index >= 0 {
+				f.device.Peers = append(f.device.Peers[:index], f.device.Peers[index+1:]...)
+			}
+			continue
+		case index < 0 && peerCfg.UpdateOnly:
+			continue
+		case index < 0:
+			f.device.Peers = append(f.device.Peers, wgtypes.Peer{PublicKey: peerCfg.PublicKey})
+			index = len(f.device.Peers) - 1
+		}
+		peer := &f.device.Peers[index]
+		if peerCfg.Endpoint != nil {
+			peer.Endpoint = peerCfg.Endpoint
+		}
+		if peerCfg.PresharedKey != nil {
+			peer.PresharedKey = *peerCfg.PresharedKey
+		}
+		if peerCfg.PersistentKeepaliveInterval != nil {
+			peer.PersistentKeepaliveInterval = *peerCfg.PersistentKeepaliveInterval
+		}
+		if peerCfg.ReplaceAllowedIPs {
+			peer.AllowedIPs = nil
+		}
+		peer.AllowedIPs = append(peer.AllowedIPs, peerCfg.AllowedIPs...)
+	}
+	return nil
+}
+
+func (f *fakeClient) Close() error {
+	return nil
+}
+
+func newTestKey(t *testing.T) wgtypes.Key {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKeyRotation(t *testing.T) {
+	t.Setenv(known.EnvPodName, "cnf-0")
+	t.Setenv(known.EnvPodNamespace, known.FleetboardSystemNamespace)
+	peerKey := newTestKey(t).PublicKey()
+
+	tests := []struct {
+		name string
+		// prepare moves the staged rotation forward before it's confirmed.
+		prepare       func(w *Wireguard, client *fakeClient, k8sClient *fake.Clientset)
+		wantPublished bool
+		// wantKey picks the key the device should use, from the current and the next key.
+		wantKey  func(current, next wgtypes.Key) wgtypes.Key
+		wantNext bool
+	}{
+		{
+			name:     "next key is published ahead",
+			prepare:  func(_ *Wireguard, _ *fakeClient, _ *fake.Clientset) {},
+			wantKey:  func(current, _ wgtypes.Key) wgtypes.Key { return current },
+			wantNext: true,
+		},
+		{
+			name: "switched after pickup period",
+			prepare: func(w *Wireguard, _ *fakeClient, _ *fake.Clientset) {
+				w.Keys.stagedAt = time.Now().Add(-KeyPickupPeriod)
+			},
+			wantPublished: true,
+			wantKey:       func(_, next wgtypes.Key) wgtypes.Key { return next },
+		},
+		{
+			name: "previous key retired once peers handshaked",
+			prepare: func(w *Wireguard, client *fakeClient, k8sClient *fake.Clientset) {
+				w.Keys.stagedAt = time.Now().Add(-KeyPickupPeriod)
+				if _, err := w.ConfirmKeyRotation(k8sClient, KeyRotationGracePeriod); err != nil {
+					t.Fatal(err)
+				}
+				client.device.Peers[0].LastHandshakeTime = time.Now().Add(time.Second)
+			},
+			wantKey: func(_, next wgtypes.Key) wgtypes.Key { return next },
+		},
+		{
+			name: "rolled back after grace period",
+			prepare: func(w *Wireguard, client *fakeClient, k8sClient *fake.Clientset) {
+				w.Keys.stagedAt = time.Now().Add(-KeyPickupPeriod)
+				if _, err := w.ConfirmKeyRotation(k8sClient, KeyRotationGracePeriod); err != nil {
+					t.Fatal(err)
+				}
+				w.Keys.rotatedAt = time.Now().Add(-KeyRotationGracePeriod)
+				client.device.Peers[0].LastHandshakeTime = w.Keys.rotatedAt.Add(-time.Second)
+			},
+			wantPublished: true,
+			wantKey:       func(current, _ wgtypes.Key) wgtypes.Key { return current },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "cnf-0", Namespace: known.FleetboardSystemNamespace}}
+			k8sClient := fake.NewSimpleClientset(pod)
+			current := newTestKey(t)
+			client := &fakeClient{device: wgtypes.Device{PrivateKey: current, PublicKey: current.PublicKey(),
+				Peers: []wgtypes.Peer{{PublicKey: peerKey, LastHandshakeTime: time.Now()}}}}
+			w := &Wireguard{
+				Spec:   &Specification{EnvConfig: known.EnvConfig{NodeName: "node-1"}},
+				client: client,
+				Keys:   &managedKeys{privateKey: current, PublicKey: current.PublicKey(), rotatedAt: time.Now()},
+			}
+
+			if err := w.RotateKey(k8sClient); err != nil {
+				t.Fatal(err)
+			}
+			next := *w.Keys.nextKey
+			if w.KeyRotationDue(time.Nanosecond, time.Now()) {
+				t.Errorf("rotation is due while in progress")
+			}
+			tt.prepare(w, client, k8sClient)
+			published, err := w.ConfirmKeyRotation(k8sClient, KeyRotationGracePeriod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantKey := tt.wantKey(current, next)
+			if published != tt.wantPublished || client.device.PrivateKey != wantKey {
+				t.Errorf("ConfirmKeyRotation() = %v with device key %s, want %v with %s", published,
+					client.device.PublicKey, tt.wantPublished, wantKey.PublicKey())
+			}
+			if gotNext := w.NextPublicKey() != ""; gotNext != tt.wantNext {
+				t.Errorf("NextPublicKey() = %q, want next key %v", w.NextPublicKey(), tt.wantNext)
+			}
+			record, err := loadKeyRecord(k8sClient, "node-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.privateKey != wantKey || (record.nextKey != nil) != tt.wantNext {
+				t.Errorf("stored key %s with next key %v, want %s with next key %v",
+					record.privateKey.PublicKey(), record.nextKey != nil, wantKey.PublicKey(), tt.wantNext)
+			}
+			got, _ := k8sClient.CoreV1().Pods(pod.Namespace).Get(context.Background(), pod.Name, metav1.GetOptions{})
+			if tt.wantNext && got.Annotations[known.NextPublicKey] != next.PublicKey().String() {
+				t.Errorf("next key annotation = %q, want %s", got.Annotations[known.NextPublicKey],
+					next.PublicKey())
+			}
+		})
+	}
+}
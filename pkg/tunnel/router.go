@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"net"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+)
+
+// Router decides the topology of inter cluster peers, which key of a peer carries which cidrs and where the peer
+// is dialed. Controllers own it, the driver asks it with its lock held, so it must not call back into the driver.
+type Router interface {
+	// AllowedIPs are cidrs routed to publicKey, one of the gateway keys of peer.
+	AllowedIPs(peer *v1alpha1.Peer, publicKey string) []string
+	// Endpoint is where the gateway in peer spec is dialed, nil means the endpoint driver takes from peer.
+	Endpoint(peer *v1alpha1.Peer) *net.UDPAddr
+}
+
+// defaultRouter routes cidrs of a peer to the gateway in its spec, until controllers set their router.
+type defaultRouter struct{}
+
+func (defaultRouter) AllowedIPs(peer *v1alpha1.Peer, publicKey string) []string {
+	if publicKey != peer.Spec.PublicKey {
+		return nil
+	}
+	return peer.Spec.PodCIDR
+}
+
+func (defaultRouter) Endpoint(_ *v1alpha1.Peer) *net.UDPAddr {
+	return nil
+}
+
+// SetRouter hands the topology of inter cluster peers to router.
+func (w *Wireguard) SetRouter(router Router) {
+	w.Lock()
+	defer w.Unlock()
+	w.router = router
+}
+
+// Refresh configures allowed ips and endpoints of the given peers as router decides now. Peers are configured in
+// order, so the last one ends up owning cidrs they share. Peers not connected are skipped.
+func (w *Wireguard) Refresh(clusterIDs ...string) error {
+	w.Lock()
+	defer w.Unlock()
+	peerCfg := make([]wgtypes.PeerConfig, 0, len(clusterIDs))
+	for _, id := range clusterIDs {
+		peer, found := w.interConnections[id]
+		if !found {
+			continue
+		}
+		cfg, err := w.allowedIPsConfig(peer)
+		if err != nil {
+			return err
+		}
+		peerCfg = append(peerCfg, cfg...)
+	}
+	if len(peerCfg) == 0 {
+		return nil
+	}
+	if err := w.client.ConfigureDevice(known.DefaultDeviceName, wgtypes.Config{
+		ReplacePeers: false,
+		Peers:        peerCfg,
+	}); err != nil {
+		return errors.Wrapf(err, "failed to refresh peers %v", clusterIDs)
+	}
+	return nil
+}
+
+// endpoint is where the gateway in peer spec is dialed, nil if we wait for peer to dial in. Caller must hold
+// the lock.
+func (w *Wireguard) endpoint(peer *v1alpha1.Peer) *net.UDPAddr {
+	if endpoint := w.router.Endpoint(peer); endpoint != nil {
+		return endpoint
+	}
+	if HolePunchingPeer(w.Spec, peer) {
+		return punchEndpoint(peer)
+	}
+	if ip := net.ParseIP(peer.Spec.Endpoint); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: peer.Spec.Port}
+	}
+	return nil
+}
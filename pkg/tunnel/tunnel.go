@@ -5,10 +5,12 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
@@ -21,9 +23,16 @@ import (
 )
 
 type managedKeys struct {
-	psk        wgtypes.Key
 	privateKey wgtypes.Key
 	PublicKey  wgtypes.Key
+	// previousKey is set while a rotation is waiting for remote peers, used to roll back.
+	previousKey *wgtypes.Key
+	rotatedAt   time.Time
+	// public keys of peers alive when rotation started, they must handshake again before we retire previousKey.
+	pendingPeers map[string]struct{}
+	// nextKey is published ahead of a rotation, the device switches to it once remote peers had time to add it.
+	nextKey  *wgtypes.Key
+	stagedAt time.Time
 }
 
 type DaemonCNFTunnelConfig struct {
@@ -34,24 +43,75 @@ type DaemonCNFTunnelConfig struct {
 	ServiceCIDR   []string
 	port          int
 	PublicKey     []string `json:"public_key"` // wire-guard public key
+	// NextPublicKey is published by the cnf pod ahead of a key rotation, empty if none.
+	NextPublicKey string
 }
 
+// wgClient is what we use of wgctrl.Client.
+type wgClient interface {
+	Device(name string) (*wgtypes.Device, error)
+	ConfigureDevice(name string, cfg wgtypes.Config) error
+	Close() error
+}
+
+// Wireguard is the kernel driver, it configures a kernel wire-guard link through wgctrl.
 type Wireguard struct {
 	interConnections map[string]*v1alpha1.Peer         // clusterID -> remote ep connection
 	innerConnections map[string]*DaemonCNFTunnelConfig // NodeID -> inner cluster connection
+	presharedKeys    map[string]wgtypes.Key            // remote public key -> pre-shared key configured
 	sync.Mutex
 	link   netlink.Link // your link
 	Spec   *Specification
-	client *wgctrl.Client
+	client wgClient
 	Keys   *managedKeys
+	router Router
 }
 
+// GetAllExistingInnerConnection returns a copy of inner cluster connections, keyed by node id.
 func (w *Wireguard) GetAllExistingInnerConnection() map[string]*DaemonCNFTunnelConfig {
-	return w.innerConnections
+	w.Lock()
+	defer w.Unlock()
+	connections := make(map[string]*DaemonCNFTunnelConfig, len(w.innerConnections))
+	for nodeID, config := range w.innerConnections {
+		connections[nodeID] = config
+	}
+	return connections
 }
 
+// GetAllExistingInterConnection returns a copy of inter cluster connections, keyed by cluster id.
 func (w *Wireguard) GetAllExistingInterConnection() map[string]*v1alpha1.Peer {
-	return w.interConnections
+	w.Lock()
+	defer w.Unlock()
+	connections := make(map[string]*v1alpha1.Peer, len(w.interConnections))
+	for clusterID, peer := range w.interConnections {
+		connections[clusterID] = peer
+	}
+	return connections
+}
+
+func (w *Wireguard) PublicKey() wgtypes.Key {
+	w.Lock()
+	defer w.Unlock()
+	return w.Keys.PublicKey
+}
+
+// DevicePeers returns peers currently configured on the wire-guard device, keyed by public key.
+func (w *Wireguard) DevicePeers() (map[string]wgtypes.Peer, error) {
+	d, err := w.client.Device(known.DefaultDeviceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "wgctrl cannot find WireGuard device")
+	}
+	peers := make(map[string]wgtypes.Peer, len(d.Peers))
+	for _, p := range d.Peers {
+		peers[p.PublicKey.String()] = p
+	}
+	return peers, nil
+}
+
+func (w *Wireguard) DeleteExistingInterConnection(clusterID string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.interConnections, clusterID)
 }
 
 func (w *Wireguard) GetExistingInnerConnection(nodeID string) (*DaemonCNFTunnelConfig, bool) {
@@ -67,6 +127,23 @@ func (w *Wireguard) DeleteExistingInnerConnection(nodeID string) {
 	delete(w.innerConnections, nodeID)
 }
 
+// Keys are public keys of the cnf pod on the device, the next key goes last if it's in a key rotation.
+func (c *DaemonCNFTunnelConfig) Keys() []string {
+	keys := make([]string, 0, 2)
+	if len(c.PublicKey) != 0 {
+		keys = append(keys, c.PublicKey[0])
+	}
+	if len(c.NextPublicKey) != 0 {
+		keys = append(keys, c.NextPublicKey)
+	}
+	return keys
+}
+
+// EndpointIP is eth0 ip of the cnf pod.
+func (c *DaemonCNFTunnelConfig) EndpointIP() string {
+	return c.endpointIP
+}
+
 func DaemonConfigFromPod(pod *v1.Pod, isLeader bool) *DaemonCNFTunnelConfig {
 	daemonConfig := &DaemonCNFTunnelConfig{
 		NodeID:        pod.Spec.NodeName,
@@ -80,31 +157,61 @@ func DaemonConfigFromPod(pod *v1.Pod, isLeader bool) *DaemonCNFTunnelConfig {
 	if !isLeader {
 		daemonConfig.SecondaryCIDR = utils.GetSpecificAnnotation(pod, known.FleetboardTunnelCIDR)
 	}
+	next := pod.Annotations[known.NextPublicKey]
+	if len(daemonConfig.PublicKey) != 0 && next != daemonConfig.PublicKey[0] {
+		daemonConfig.NextPublicKey = next
+	}
 	return daemonConfig
 }
 
-func NewTunnel(spec *Specification) (*Wireguard, error) {
+// DeviceUp tells if the wire-guard device exists and is up.
+func DeviceUp() error {
+	link, err := netlink.LinkByName(known.DefaultDeviceName)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get wireguard link by name %s", known.DefaultDeviceName)
+	}
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		return errors.Errorf("%s is down", known.DefaultDeviceName)
+	}
+	return nil
+}
+
+// NewTunnel creates the wire-guard device with the driver chosen in spec.
+func NewTunnel(k8sClient kubernetes.Interface, spec *Specification) (TunnelDriver, error) {
+	if spec.TunnelDriver == DriverUserspace {
+		return newUserspaceWireguard(k8sClient, spec)
+	}
+	return newWireguard(k8sClient, spec, (*Wireguard).setWGLink)
+}
+
+// newWireguard configures the device through wgctrl, createLink decides how the device is created.
+func newWireguard(k8sClient kubernetes.Interface, spec *Specification,
+	createLink func(w *Wireguard) error) (*Wireguard, error) {
 	var err error
 
 	w := &Wireguard{
 		interConnections: make(map[string]*v1alpha1.Peer),
 		innerConnections: make(map[string]*DaemonCNFTunnelConfig),
+		presharedKeys:    make(map[string]wgtypes.Key),
 		Keys:             &managedKeys{},
 		Spec:             spec,
+		router:           defaultRouter{},
 	}
 
-	if err = w.setWGLink(); err != nil {
+	if err = createLink(w); err != nil {
 		return nil, errors.Wrap(err, "failed to add WireGuard link")
 	}
 
 	// Create the wireguard controller.
-	if w.client, err = wgctrl.New(); err != nil {
+	client, err := wgctrl.New()
+	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("wgctrl is not available on this system")
 		}
 
 		return nil, errors.Wrap(err, "failed to open wgctl client")
 	}
+	w.client = client
 
 	defer func() {
 		if err != nil {
@@ -116,7 +223,7 @@ func NewTunnel(spec *Specification) (*Wireguard, error) {
 	}()
 
 	// set wire-guard Keys.
-	if err = w.setKeyPair(); err != nil {
+	if err = w.setKeyPair(k8sClient); err != nil {
 		return nil, err
 	}
 	// Configure the device - still not up.
@@ -136,7 +243,7 @@ func NewTunnel(spec *Specification) (*Wireguard, error) {
 	return w, err
 }
 
-func (w *Wireguard) Init(client *kubernetes.Clientset) error {
+func (w *Wireguard) Init(client kubernetes.Interface) error {
 	w.Lock()
 	defer w.Unlock()
 
@@ -160,23 +267,62 @@ func (w *Wireguard) Init(client *kubernetes.Clientset) error {
 	klog.Infof("WireGuard device %s, is up on i/f number %d, listening on port :%d, with key %s",
 		w.link.Attrs().Name, l.Index, d.ListenPort, d.PublicKey)
 
+	// a restarted container may find the next key of a rotation it has not finished, or a stale one.
+	nextPublicKey := ""
+	if w.Keys.nextKey != nil {
+		nextPublicKey = w.Keys.nextKey.PublicKey().String()
+	}
+	if err = utils.AddAnnotationToSelf(client, known.NextPublicKey, nextPublicKey, true); err != nil {
+		return err
+	}
 	return utils.AddAnnotationToSelf(client, known.PublicKey, w.Keys.PublicKey.String(), true)
 }
 
-func CreateAndUpTunnel(k8sClient *kubernetes.Clientset, agentSpec *Specification) (*Wireguard, error) {
-	w, err := NewTunnel(agentSpec)
+func CreateAndUpTunnel(k8sClient *kubernetes.Clientset, agentSpec *Specification) (TunnelDriver, error) {
+	w, err := NewTunnel(k8sClient, agentSpec)
 	if err != nil {
-		klog.Fatal(err)
 		return nil, err
 	}
 	// up the interface.
 	if errInit := w.Init(k8sClient); errInit != nil {
-		klog.Fatal(errInit)
+		// leave nothing behind for the next try.
+		if errCleanup := w.Cleanup(); errCleanup != nil {
+			klog.Errorf("failed to clean up wireguard tunnel: %v", errCleanup)
+		}
 		return nil, errInit
 	}
 	return w, nil
 }
 
-func (w *Wireguard) Cleanup() error {
+// Close closes the wgctrl client, wire-guard and ip-in-ip devices are left as they are.
+func (w *Wireguard) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.client != nil {
+		if err := w.client.Close(); err != nil {
+			return errors.Wrap(err, "failed to close wgctrl client")
+		}
+		w.client = nil
+	}
 	return nil
 }
+
+// Cleanup closes the driver and removes wire-guard and ip-in-ip devices, routes through them go along.
+func (w *Wireguard) Cleanup() error {
+	if err := w.Close(); err != nil {
+		klog.Error(err)
+	}
+	return CleanupLeftovers()
+}
+
+// CleanupLeftovers removes devices of cnf without a running tunnel, e.g. in cleanup mode.
+func CleanupLeftovers() error {
+	var errs []error
+	if err := deleteExistingLink(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := deleteIPIPLink(); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
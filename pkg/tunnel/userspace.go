@@ -0,0 +1,114 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/ipc"
+	"golang.zx2c4.com/wireguard/tun"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/fleetboard-io/fleetboard/pkg/known"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// userspaceWireguard runs wireguard-go in cnf on a TUN device. wgctrl finds it by the uapi socket, so all
+// the tunnel configuration is shared with the kernel driver.
+type userspaceWireguard struct {
+	*Wireguard
+	device *device.Device
+	uapi   net.Listener
+}
+
+func newUserspaceWireguard(k8sClient kubernetes.Interface, spec *Specification) (*userspaceWireguard, error) {
+	u := &userspaceWireguard{}
+	w, err := newWireguard(k8sClient, spec, u.setTUNLink)
+	if err != nil {
+		u.close()
+		return nil, err
+	}
+	u.Wireguard = w
+	return u, nil
+}
+
+// setTUNLink creates a TUN device and serves wire-guard on it.
+func (u *userspaceWireguard) setTUNLink(w *Wireguard) error {
+	if err := deleteExistingLink(); err != nil {
+		return err
+	}
+
+	tunDevice, err := tun.CreateTUN(known.DefaultDeviceName, device.DefaultMTU)
+	if err != nil {
+		return errors.Wrap(err, "failed to create TUN device")
+	}
+	if err = u.serve(known.DefaultDeviceName, tunDevice); err != nil {
+		return err
+	}
+
+	if w.link, err = netlink.LinkByName(known.DefaultDeviceName); err != nil {
+		return errors.Wrap(err, "failed to get TUN device")
+	}
+	return nil
+}
+
+// serve runs wire-guard on tunDevice, wgctrl configures it through the uapi socket named after the device.
+func (u *userspaceWireguard) serve(name string, tunDevice tun.Device) error {
+	u.device = device.NewDevice(tunDevice, conn.NewDefaultBind(),
+		device.NewLogger(device.LogLevelError, fmt.Sprintf("(%s) ", name)))
+
+	fileUAPI, err := ipc.UAPIOpen(name)
+	if err != nil {
+		return errors.Wrap(err, "failed to open uapi socket")
+	}
+	if u.uapi, err = ipc.UAPIListen(name, fileUAPI); err != nil {
+		return errors.Wrap(err, "failed to listen on uapi socket")
+	}
+	go u.serveUAPI()
+	return nil
+}
+
+func (u *userspaceWireguard) serveUAPI() {
+	for {
+		c, err := u.uapi.Accept()
+		if err != nil {
+			klog.Infof("stop serving uapi of %s: %v", known.DefaultDeviceName, err)
+			return
+		}
+		go u.device.IpcHandle(c)
+	}
+}
+
+// Close stops wireguard-go, the TUN device goes along with it since it belongs to this process.
+func (u *userspaceWireguard) Close() error {
+	var err error
+	if u.Wireguard != nil {
+		err = u.Wireguard.Close()
+	}
+	u.close()
+	return err
+}
+
+func (u *userspaceWireguard) Cleanup() error {
+	var err error
+	if u.Wireguard != nil {
+		err = u.Wireguard.Cleanup()
+	}
+	u.close()
+	return err
+}
+
+func (u *userspaceWireguard) close() {
+	if u.uapi != nil {
+		if err := u.uapi.Close(); err != nil {
+			klog.Errorf("failed to close uapi listener: %v", err)
+		}
+	}
+	if u.device != nil {
+		// closing the device removes the TUN device too.
+		u.device.Close()
+	}
+}
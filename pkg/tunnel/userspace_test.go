@@ -0,0 +1,91 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/tun/tuntest"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestUserspaceDevice(t *testing.T) {
+	name := fmt.Sprintf("fbtest%d", os.Getpid()%100000)
+	u := &userspaceWireguard{}
+	if err := u.serve(name, tuntest.NewChannelTUN().TUN()); err != nil {
+		t.Skipf("can't serve wire-guard uapi: %v", err)
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			u.close()
+		}
+	}()
+	client, err := wgctrl.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	privateKey, peerKey := newTestKey(t), newTestKey(t).PublicKey()
+	_, cidr, _ := net.ParseCIDR("20.112.0.0/16")
+	tests := []struct {
+		name      string
+		cfg       wgtypes.Config
+		wantPeers int
+	}{
+		{
+			name: "private key",
+			cfg:  wgtypes.Config{PrivateKey: &privateKey, ReplacePeers: true},
+		},
+		{
+			name: "peer added",
+			cfg: wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+				PublicKey:         peerKey,
+				Endpoint:          &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 51871},
+				ReplaceAllowedIPs: true,
+				AllowedIPs:        []net.IPNet{*cidr},
+			}}},
+			wantPeers: 1,
+		},
+		{
+			name:      "allowed ips of standby peer cleared",
+			cfg:       wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: peerKey, ReplaceAllowedIPs: true}}},
+			wantPeers: 1,
+		},
+		{
+			name: "peer removed",
+			cfg:  wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: peerKey, Remove: true}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err = client.ConfigureDevice(name, tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			d, errDevice := client.Device(name)
+			if errDevice != nil {
+				t.Fatal(errDevice)
+			}
+			if d.PublicKey != privateKey.PublicKey() || len(d.Peers) != tt.wantPeers {
+				t.Fatalf("device %s with %d peers, want %s with %d peers", d.PublicKey, len(d.Peers),
+					privateKey.PublicKey(), tt.wantPeers)
+			}
+			for _, peer := range tt.cfg.Peers {
+				if !peer.Remove && !sameSubnets(d.Peers[0].AllowedIPs, peer.AllowedIPs) {
+					t.Errorf("allowed ips = %v, want %v", d.Peers[0].AllowedIPs, peer.AllowedIPs)
+				}
+			}
+		})
+	}
+
+	if err = u.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closed = true
+	if _, err = client.Device(name); err == nil {
+		t.Errorf("device %s is still served after close", name)
+	}
+}
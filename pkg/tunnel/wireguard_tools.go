@@ -2,9 +2,11 @@ package tunnel
 
 import (
 	"net"
+	"reflect"
 	"time"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 
 	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
@@ -15,12 +17,8 @@ import (
 
 // Create new wg link and assign addr from local subnets.
 func (w *Wireguard) setWGLink() error {
-	// delete existing wg device if needed
-	if link, err := netlink.LinkByName(known.DefaultDeviceName); err == nil {
-		// delete existing device
-		if err := netlink.LinkDel(link); err != nil {
-			return errors.Wrap(err, "failed to delete existing WireGuard device")
-		}
+	if err := deleteExistingLink(); err != nil {
+		return err
 	}
 
 	// Create the wg device (ip link add dev $DefaultDeviceName type wireguard).
@@ -40,6 +38,17 @@ func (w *Wireguard) setWGLink() error {
 	return nil
 }
 
+// delete existing wg device if needed
+func deleteExistingLink() error {
+	if link, err := netlink.LinkByName(known.DefaultDeviceName); err == nil {
+		// delete existing device
+		if err := netlink.LinkDel(link); err != nil {
+			return errors.Wrap(err, "failed to delete existing WireGuard device")
+		}
+	}
+	return nil
+}
+
 func (w *Wireguard) RemoveInterClusterTunnel(key *wgtypes.Key) error {
 	klog.Infof("Removing WireGuard peer with key %s", key)
 
@@ -62,28 +71,18 @@ func (w *Wireguard) RemoveInterClusterTunnel(key *wgtypes.Key) error {
 	return nil
 }
 
-func (w *Wireguard) AddInterClusterTunnel(peer *v1alpha1.Peer) error {
-	var endpoint *net.UDPAddr
+// AddInterClusterTunnel connects to peer, psk is the pre-shared key of this pair and nil means not using one.
+func (w *Wireguard) AddInterClusterTunnel(peer *v1alpha1.Peer, psk *wgtypes.Key) error {
 	if w.Spec.ClusterID == peer.Spec.ClusterID {
 		klog.Infof("Will not connect to self")
 		return nil
 	}
 
-	// Parse remote addresses and allowed IPs.
 	remoteIP := net.ParseIP(peer.Spec.Endpoint)
-	remotePort := peer.Spec.Port
 	if remoteIP == nil {
 		klog.Infof("failed to parse remote IP %s, never mind just ignore.", peer.Spec.Endpoint)
-		endpoint = nil
-	} else {
-		endpoint = &net.UDPAddr{
-			IP:   remoteIP,
-			Port: remotePort,
-		}
 	}
 
-	allowedIPs := parseSubnets(peer.Spec.PodCIDR)
-
 	// Parse remote public key.
 	remoteKey, err := wgtypes.ParseKey(peer.Spec.PublicKey)
 	if err != nil {
@@ -96,52 +95,53 @@ func (w *Wireguard) AddInterClusterTunnel(peer *v1alpha1.Peer) error {
 	defer w.Unlock()
 
 	// Delete or update old peers for ClusterID.
+	var removedGateways []wgtypes.PeerConfig
 	oldCon, found := w.interConnections[peer.Spec.ClusterID]
 	if found {
+		removedGateways = removedGatewayConfigs(oldCon, peer)
 		if oldKey, e := wgtypes.ParseKey(oldCon.Spec.PublicKey); e == nil {
-			// because every time we change the public key.
+			// keys survive restarts, so the same key may come back with another endpoint or cidr.
 			if oldKey.String() == remoteKey.String() {
-				// Existing connection, update status and skip.
-				klog.Infof("Skipping connect for existing peer key %s", oldKey)
-				return nil
+				if interConnectionUnchanged(oldCon, peer) && w.presharedKeyUnchanged(remoteKey, psk) {
+					// Existing connection, update status and skip.
+					klog.Infof("Skipping connect for existing peer key %s", oldKey)
+					return nil
+				}
+			} else {
+				// new peer will take over subnets so can ignore error
+				_ = w.RemoveInterClusterTunnel(&oldKey)
 			}
-			// new peer will take over subnets so can ignore error
-			_ = w.RemoveInterClusterTunnel(&oldKey)
 		}
 
 		delete(w.interConnections, peer.Spec.ClusterID)
 	}
-
 	// create connection, overwrite existing connection
-	klog.Infof("Adding connection for cluster %s, with allowed ips %s,"+
-		" %v", peer.Spec.ClusterID, allowedIPs, peer)
 	w.interConnections[peer.Spec.ClusterID] = peer
-
-	ka := 10 * time.Second
-	peerCfg := []wgtypes.PeerConfig{{
-		PublicKey:  remoteKey,
-		Remove:     false,
-		UpdateOnly: false,
-		// PresharedKey: w.psk, remove psk for now, because we haven't figure out how to keep and transfer it.
-		Endpoint:                    endpoint,
-		PersistentKeepaliveInterval: &ka,
-		ReplaceAllowedIPs:           true,
-		AllowedIPs:                  allowedIPs,
-	}}
+	klog.Infof("Adding connection for cluster %s, %v", peer.Spec.ClusterID, peer)
+	peerCfg, err := w.interPeerConfigs(peer, psk)
+	if err != nil {
+		return err
+	}
 
 	err = w.client.ConfigureDevice(known.DefaultDeviceName, wgtypes.Config{
 		ReplacePeers: false,
-		Peers:        peerCfg,
+		Peers:        append(removedGateways, peerCfg...),
 	})
 	if err != nil {
 		return errors.Wrap(err, "failed to configure peer")
 	}
+	for _, cfg := range peerCfg {
+		w.setPresharedKey(cfg.PublicKey, psk)
+	}
 
 	klog.Infof("Done connecting endpoint peer %s@%s", remoteKey, remoteIP)
 	return nil
 }
 
 func (w *Wireguard) RemoveInnerClusterTunnel(key *wgtypes.Key) error {
+	if w.Spec.InnerClusterTransport == TransportIPIP {
+		return nil
+	}
 	klog.Infof("Removing WireGuard peer with key %s", key)
 	peerCfg := []wgtypes.PeerConfig{
 		{
@@ -162,23 +162,9 @@ func (w *Wireguard) RemoveInnerClusterTunnel(key *wgtypes.Key) error {
 	return nil
 }
 
-func (w *Wireguard) AddInnerClusterTunnel(daemonPeerConfig *DaemonCNFTunnelConfig) error {
-	var endpoint *net.UDPAddr
-	// Parse remote addresses and allowed IPs.
-	remoteIP := net.ParseIP(daemonPeerConfig.endpointIP)
-	remotePort := daemonPeerConfig.port
-	if remoteIP == nil {
-		return errors.Errorf("invalid eth0 IP '%s' of pod %s on node %s",
-			daemonPeerConfig.endpointIP, daemonPeerConfig.PodID, daemonPeerConfig.NodeID)
-	} else {
-		endpoint = &net.UDPAddr{
-			IP:   remoteIP,
-			Port: remotePort,
-		}
-	}
-
-	allowedIPs := parseSubnets(daemonPeerConfig.SecondaryCIDR)
-
+// AddInnerClusterTunnel connects to another cnf pod, psk is the pre-shared key of this pair and nil means
+// not using one.
+func (w *Wireguard) AddInnerClusterTunnel(daemonPeerConfig *DaemonCNFTunnelConfig, psk *wgtypes.Key) error {
 	// Parse remote public key.
 	if len(daemonPeerConfig.PublicKey) == 0 {
 		return errors.Errorf("invalid empty public key of pod %s on node %s", daemonPeerConfig.PodID, daemonPeerConfig.NodeID)
@@ -194,17 +180,22 @@ func (w *Wireguard) AddInnerClusterTunnel(daemonPeerConfig *DaemonCNFTunnelConfi
 	defer w.Unlock()
 
 	// Delete or update old peers for ClusterID.
+	peerCfg := make([]wgtypes.PeerConfig, 0, 3)
 	oldCon, found := w.innerConnections[daemonPeerConfig.NodeID]
 	if found {
+		peerCfg = append(peerCfg, removedNextKeyConfigs(oldCon, daemonPeerConfig)...)
 		if oldKey, e := wgtypes.ParseKey(oldCon.PublicKey[0]); e == nil {
-			// because every time when cnf pod restart it will change the public key and the tunnel should be re-build.
+			// a restarted cnf pod keeps its key, but may come back with another pod ip.
 			if oldKey.String() == remoteKey.String() {
-				// Existing connection, update status and skip.
-				klog.Infof("Skipping connect for existing daemonPeerConfig key %s", oldKey)
-				return nil
+				if innerConnectionUnchanged(oldCon, daemonPeerConfig) && w.presharedKeyUnchanged(remoteKey, psk) {
+					// Existing connection, update status and skip.
+					klog.Infof("Skipping connect for existing daemonPeerConfig key %s", oldKey)
+					return nil
+				}
+			} else {
+				// new daemonPeerConfig will take over subnets so can ignore error
+				_ = w.RemoveInnerClusterTunnel(&oldKey)
 			}
-			// new daemonPeerConfig will take over subnets so can ignore error
-			_ = w.RemoveInnerClusterTunnel(&oldKey)
 		}
 
 		delete(w.innerConnections, daemonPeerConfig.NodeID)
@@ -213,52 +204,215 @@ func (w *Wireguard) AddInnerClusterTunnel(daemonPeerConfig *DaemonCNFTunnelConfi
 	// create connection, overwrite existing connection
 	klog.Infof("Adding inner cluster tunnel connection for node %s, %v", daemonPeerConfig.NodeID, daemonPeerConfig)
 	w.innerConnections[daemonPeerConfig.NodeID] = daemonPeerConfig
+	if w.Spec.InnerClusterTransport == TransportIPIP {
+		// ip-in-ip needs no peer on the device, routes are all it takes.
+		return nil
+	}
 
-	// configure daemonPeerConfig 10s default todo make it configurable.
-	ka := 10 * time.Second
-	peerCfg := []wgtypes.PeerConfig{{
-		PublicKey:                   remoteKey,
-		Remove:                      false,
-		UpdateOnly:                  false,
-		Endpoint:                    endpoint,
-		PersistentKeepaliveInterval: &ka,
-		ReplaceAllowedIPs:           true,
-		AllowedIPs:                  allowedIPs,
-	}}
-
+	cfg, err := innerPeerConfigs(daemonPeerConfig, psk)
+	if err != nil {
+		return err
+	}
 	err = w.client.ConfigureDevice(known.DefaultDeviceName, wgtypes.Config{
 		ReplacePeers: false,
-		Peers:        peerCfg,
+		Peers:        append(peerCfg, cfg...),
 	})
 	if err != nil {
 		return errors.Wrap(err, "failed to configure daemonPeerConfig")
 	}
+	for _, c := range cfg {
+		w.setPresharedKey(c.PublicKey, psk)
+	}
 
-	klog.Infof("Done connecting endpoint daemonPeerConfig %s@%s", remoteKey, remoteIP)
+	klog.Infof("Done connecting endpoint daemonPeerConfig %s@%s", remoteKey, daemonPeerConfig.endpointIP)
 	return nil
 }
 
-func (w *Wireguard) setKeyPair() error {
+func (w *Wireguard) setKeyPair(k8sClient kubernetes.Interface) error {
 	var err error
 	// Generate local Keys and set public key in BackendConfig.
-	var psk, priKey, pubKey wgtypes.Key
-
-	if psk, err = wgtypes.GenerateKey(); err != nil {
-		return errors.Wrap(err, "error generating pre-shared key")
-	}
-
-	w.Keys.psk = psk
+	var priKey, pubKey wgtypes.Key
 
-	if priKey, err = wgtypes.GeneratePrivateKey(); err != nil {
-		return errors.Wrap(err, "error generating private key")
+	// reuse the key of this node, so peers don't need to rebuild tunnels when we restart.
+	record, err := loadOrCreateKeyRecord(k8sClient, w.Spec.NodeName)
+	if err != nil {
+		return errors.Wrap(err, "error loading private key")
 	}
+	priKey = record.privateKey
 	w.Keys.privateKey = priKey
+	w.Keys.previousKey = record.previousKey
+	w.Keys.rotatedAt = record.rotatedAt
+	w.Keys.nextKey = record.nextKey
+	w.Keys.stagedAt = record.stagedAt
 
 	pubKey = priKey.PublicKey()
 	w.Keys.PublicKey = pubKey
 	return nil
 }
 
+// presharedKeyUnchanged tells if the peer is already configured with psk, caller must hold the lock.
+func (w *Wireguard) presharedKeyUnchanged(remoteKey wgtypes.Key, psk *wgtypes.Key) bool {
+	old, found := w.presharedKeys[remoteKey.String()]
+	if psk == nil {
+		return !found
+	}
+	return found && old == *psk
+}
+
+// setPresharedKey records psk the peer is configured with, caller must hold the lock.
+func (w *Wireguard) setPresharedKey(remoteKey wgtypes.Key, psk *wgtypes.Key) {
+	if psk == nil {
+		delete(w.presharedKeys, remoteKey.String())
+		return
+	}
+	w.presharedKeys[remoteKey.String()] = *psk
+}
+
+// presharedKeyOrZero returns zero key to clear the pre-shared key of peer when psk is nil.
+func presharedKeyOrZero(psk *wgtypes.Key) *wgtypes.Key {
+	if psk == nil {
+		return &wgtypes.Key{}
+	}
+	return psk
+}
+
+// interAllowedIPs are cidrs router routes to the gateway of an inter cluster peer with the given key,
+// caller must hold the lock.
+func (w *Wireguard) interAllowedIPs(peer *v1alpha1.Peer, key string) []net.IPNet {
+	return parseSubnets(w.router.AllowedIPs(peer, key))
+}
+
+// allowedIPsConfig only touches allowed ips of all the gateways of a peer already on the device, and where the
+// gateway in peer spec is dialed. Caller must hold the lock.
+func (w *Wireguard) allowedIPsConfig(peer *v1alpha1.Peer) ([]wgtypes.PeerConfig, error) {
+	standby := make([]wgtypes.PeerConfig, 0, len(peer.Spec.Gateways))
+	active := make([]wgtypes.PeerConfig, 0, 1)
+	for _, gatewayKey := range GatewayKeys(peer) {
+		key, err := wgtypes.ParseKey(gatewayKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public key of peer %s", peer.Spec.ClusterID)
+		}
+		cfg := wgtypes.PeerConfig{
+			PublicKey:         key,
+			UpdateOnly:        true,
+			ReplaceAllowedIPs: true,
+			AllowedIPs:        w.interAllowedIPs(peer, gatewayKey),
+		}
+		if gatewayKey == peer.Spec.PublicKey {
+			cfg.Endpoint = w.endpoint(peer)
+		}
+		if len(cfg.AllowedIPs) == 0 {
+			standby = append(standby, cfg)
+			continue
+		}
+		active = append(active, cfg)
+	}
+	// active ones go last, so they end up owning the cidrs.
+	return append(standby, active...), nil
+}
+
+// interPeerConfigs configures every key of peer on the device, caller must hold the lock.
+func (w *Wireguard) interPeerConfigs(peer *v1alpha1.Peer, psk *wgtypes.Key) ([]wgtypes.PeerConfig, error) {
+	remoteKey, err := wgtypes.ParseKey(peer.Spec.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse peer public key")
+	}
+	endpoint := w.endpoint(peer)
+	gatewayCfg, err := w.gatewayPeerConfigs(peer, psk)
+	if err != nil {
+		return nil, err
+	}
+	nextKeyCfg, err := nextKeyPeerConfigs(peer, endpoint, psk)
+	if err != nil {
+		return nil, err
+	}
+
+	ka := 10 * time.Second
+	peerCfg := []wgtypes.PeerConfig{{
+		PublicKey:                   remoteKey,
+		PresharedKey:                presharedKeyOrZero(psk),
+		Endpoint:                    endpoint,
+		PersistentKeepaliveInterval: &ka,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  w.interAllowedIPs(peer, peer.Spec.PublicKey),
+	}}
+	return append(append(peerCfg, gatewayCfg...), nextKeyCfg...), nil
+}
+
+// innerPeerConfigs configures the keys of another cnf pod on the device, its next key stands by until the cnf pod
+// switches to it.
+func innerPeerConfigs(config *DaemonCNFTunnelConfig, psk *wgtypes.Key) ([]wgtypes.PeerConfig, error) {
+	remoteIP := net.ParseIP(config.endpointIP)
+	if remoteIP == nil {
+		return nil, errors.Errorf("invalid eth0 IP '%s' of pod %s on node %s", config.endpointIP, config.PodID,
+			config.NodeID)
+	}
+	if len(config.PublicKey) == 0 {
+		return nil, errors.Errorf("invalid empty public key of pod %s on node %s", config.PodID, config.NodeID)
+	}
+	remoteKey, err := wgtypes.ParseKey(config.PublicKey[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse daemonPeerConfig public key")
+	}
+	endpoint := &net.UDPAddr{IP: remoteIP, Port: config.port}
+
+	// configure daemonPeerConfig 10s default todo make it configurable.
+	ka := 10 * time.Second
+	peerCfg := []wgtypes.PeerConfig{{
+		PublicKey:                   remoteKey,
+		PresharedKey:                presharedKeyOrZero(psk),
+		Endpoint:                    endpoint,
+		PersistentKeepaliveInterval: &ka,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  parseSubnets(config.SecondaryCIDR),
+	}}
+	if len(config.NextPublicKey) != 0 {
+		nextKey, errKey := wgtypes.ParseKey(config.NextPublicKey)
+		if errKey != nil {
+			return nil, errors.Wrap(errKey, "failed to parse daemonPeerConfig next key")
+		}
+		peerCfg = append(peerCfg, wgtypes.PeerConfig{
+			PublicKey:                   nextKey,
+			PresharedKey:                presharedKeyOrZero(psk),
+			Endpoint:                    endpoint,
+			PersistentKeepaliveInterval: &ka,
+			ReplaceAllowedIPs:           true,
+		})
+	}
+	return peerCfg, nil
+}
+
+func interConnectionUnchanged(oldPeer, newPeer *v1alpha1.Peer) bool {
+	return oldPeer.Spec.Endpoint == newPeer.Spec.Endpoint && oldPeer.Spec.Port == newPeer.Spec.Port &&
+		oldPeer.Spec.NextPublicKey == newPeer.Spec.NextPublicKey &&
+		oldPeer.Status.ObservedEndpoint == newPeer.Status.ObservedEndpoint &&
+		reflect.DeepEqual(oldPeer.Spec.PodCIDR, newPeer.Spec.PodCIDR) &&
+		reflect.DeepEqual(oldPeer.Spec.Gateways, newPeer.Spec.Gateways)
+}
+
+// removedNextKeyConfigs removes the next key of oldConfig unless newConfig still has it.
+func removedNextKeyConfigs(oldConfig, newConfig *DaemonCNFTunnelConfig) []wgtypes.PeerConfig {
+	if len(oldConfig.NextPublicKey) == 0 {
+		return nil
+	}
+	for _, key := range newConfig.Keys() {
+		if key == oldConfig.NextPublicKey {
+			return nil
+		}
+	}
+	key, err := wgtypes.ParseKey(oldConfig.NextPublicKey)
+	if err != nil {
+		return nil
+	}
+	return []wgtypes.PeerConfig{{PublicKey: key, Remove: true}}
+}
+
+func innerConnectionUnchanged(oldConfig, newConfig *DaemonCNFTunnelConfig) bool {
+	return oldConfig.endpointIP == newConfig.endpointIP && oldConfig.port == newConfig.port &&
+		oldConfig.NextPublicKey == newConfig.NextPublicKey &&
+		reflect.DeepEqual(oldConfig.SecondaryCIDR, newConfig.SecondaryCIDR)
+}
+
 // Parse CIDR string and skip errors.
 func parseSubnets(subnets []string) []net.IPNet {
 	nets := make([]net.IPNet, 0, len(subnets))
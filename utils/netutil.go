@@ -53,6 +53,17 @@ func FindClusterAvailableCIDR(clusterCIDR string, existingCIDRs []string) (strin
 	return findAvailableCIDR(clusterCIDR, existingCIDRs, networkBits)
 }
 
+// ClusterCIDRCapacity is how many node cidrs FindClusterAvailableCIDR allocates from clusterCIDR at most.
+func ClusterCIDRCapacity(clusterCIDR string) (int, error) {
+	networkBits, err := divideClusterNetwork(clusterCIDR)
+	if err != nil {
+		return 0, err
+	}
+	_, network, _ := net.ParseCIDR(clusterCIDR)
+	prefixBits, _ := network.Mask.Size()
+	return 1 << (networkBits - prefixBits), nil
+}
+
 /*
 divideTunnelNetwork and divideClusterNetwork divide network cidr for peer clusters and nodes in cluster
 as dynamically as possibly.
@@ -243,6 +243,31 @@ func TestFindClusterAvailableCIDR(t *testing.T) {
 	}
 }
 
+func TestClusterCIDRCapacity(t *testing.T) {
+	tests := []struct {
+		clusterCIDR string
+		want        int
+		wantErr     bool
+	}{
+		{clusterCIDR: "10.0.0.0/18", want: 64},
+		{clusterCIDR: "10.0.0.0/16", want: 256},
+		{clusterCIDR: "10.0.0.0/12", want: 1024},
+		{clusterCIDR: "10.0.0.0/24", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clusterCIDR, func(t *testing.T) {
+			got, err := ClusterCIDRCapacity(tt.clusterCIDR)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ClusterCIDRCapacity() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ClusterCIDRCapacity() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFindAvailableCIDR(t *testing.T) {
 	type args struct {
 		networkCIDR   string
@@ -45,9 +45,14 @@ func ApplyPeerWithRetry(client clientset.Interface, peer *v1alpha1.Peer) error {
 				curObj.Spec.PodCIDR = peer.Spec.PodCIDR
 				curObj.Spec.Endpoint = peer.Spec.Endpoint
 				curObj.Spec.PublicKey = peer.Spec.PublicKey
+				curObj.Spec.NextPublicKey = peer.Spec.NextPublicKey
+				curObj.Spec.PresharedKeyExchange = peer.Spec.PresharedKeyExchange
 				curObj.Spec.ClusterID = peer.Spec.ClusterID
 				curObj.Spec.IsPublic = peer.Spec.IsPublic
 				curObj.Spec.Port = peer.Spec.Port
+				curObj.Spec.FallbackTransport = peer.Spec.FallbackTransport
+				curObj.Spec.FallbackPort = peer.Spec.FallbackPort
+				curObj.Spec.Gateways = peer.Spec.Gateways
 				_, lastError = client.FleetboardV1alpha1().Peers(peer.GetNamespace()).
 					Update(context.TODO(), curObj, metav1.UpdateOptions{})
 			}
@@ -59,22 +64,23 @@ func ApplyPeerWithRetry(client clientset.Interface, peer *v1alpha1.Peer) error {
 		})
 }
 
+// DeletePeerWithRetry deletes the peer, errors retrying can't fix stop it at once.
 func DeletePeerWithRetry(client clientset.Interface, name, namespace string) error {
-	var err error
-	err = wait.ExponentialBackoffWithContext(context.TODO(), retry.DefaultBackoff,
+	var lastError error
+	err := wait.ExponentialBackoffWithContext(context.TODO(), retry.DefaultBackoff,
 		func(ctx context.Context) (bool, error) {
-			if err = client.FleetboardV1alpha1().Peers(namespace).
-				Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil {
-				return false, err
-			}
-
-			if err == nil || (err != nil && errors.IsNotFound(err)) {
+			lastError = client.FleetboardV1alpha1().Peers(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+			if lastError == nil || errors.IsNotFound(lastError) {
 				return true, nil
 			}
+			if errors.IsForbidden(lastError) || errors.IsUnauthorized(lastError) || errors.IsBadRequest(lastError) {
+				return false, lastError
+			}
+			klog.Infof("delete peer %s with error %v, retrying", name, lastError)
 			return false, nil
 		})
-	if err == nil {
-		return nil
+	if err != nil && lastError != nil {
+		return lastError
 	}
 	return err
 }
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/fleetboard-io/fleetboard/pkg/apis/fleetboard.io/v1alpha1"
+	"github.com/fleetboard-io/fleetboard/pkg/generated/clientset/versioned/fake"
+)
+
+func TestDeletePeerWithRetry(t *testing.T) {
+	resource := schema.GroupResource{Group: "fleetboard.io", Resource: "peers"}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   bool
+		wantCalls int
+	}{
+		{
+			name:      "deleted at once",
+			wantCalls: 1,
+		},
+		{
+			name: "retried until deleted",
+			errs: []error{apierrors.NewServiceUnavailable("hub is down"),
+				apierrors.NewTooManyRequests("slow down", 0)},
+			wantCalls: 3,
+		},
+		{
+			name:      "forbidden is not retried",
+			errs:      []error{apierrors.NewForbidden(resource, "cluster-a", nil)},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peer := &v1alpha1.Peer{ObjectMeta: metav1.ObjectMeta{Name: "cluster-a", Namespace: "fleetboard-system"}}
+			client := fake.NewSimpleClientset(peer)
+			calls := 0
+			client.PrependReactor("delete", "peers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return true, nil, tt.errs[calls-1]
+				}
+				return false, nil, nil
+			})
+			err := DeletePeerWithRetry(client, peer.Name, peer.Namespace)
+			if (err != nil) != tt.wantErr || calls != tt.wantCalls {
+				t.Fatalf("DeletePeerWithRetry() = %v after %d calls, want error %v after %d calls", err, calls,
+					tt.wantErr, tt.wantCalls)
+			}
+		})
+	}
+}
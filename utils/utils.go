@@ -68,7 +68,15 @@ func AddAnnotationToSelf(client kubernetes.Interface, annotationKey, annotationV
 }
 
 func UpdatePodLabels(client kubernetes.Interface, podName string, isLeader bool) {
-	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+	if err := UpdatePodLabel(client, podName, known.LeaderCNFLabelKey, isLeader); err != nil {
+		klog.Errorf("can't set label for myself")
+		return
+	}
+}
+
+// UpdatePodLabel sets the label key to "true" on the cnf pod, or removes it if set is false.
+func UpdatePodLabel(client kubernetes.Interface, podName, key string, set bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		pod, err := client.CoreV1().Pods(known.FleetboardSystemNamespace).Get(context.TODO(), podName, metav1.GetOptions{})
 		if err != nil {
 			return err
@@ -78,22 +86,21 @@ func UpdatePodLabels(client kubernetes.Interface, podName string, isLeader bool)
 			pod.Labels = make(map[string]string)
 		}
 
-		if isLeader {
-			pod.Labels[known.LeaderCNFLabelKey] = "true"
+		if set {
+			if pod.Labels[key] == "true" {
+				return nil // not need to update
+			}
+			pod.Labels[key] = "true"
 		} else {
-			if _, ok := pod.Labels[known.LeaderCNFLabelKey]; !ok {
+			if _, ok := pod.Labels[key]; !ok {
 				return nil // not need to update
 			}
-			delete(pod.Labels, known.LeaderCNFLabelKey)
+			delete(pod.Labels, key)
 		}
 
 		_, err = client.CoreV1().Pods(known.FleetboardSystemNamespace).Update(context.TODO(), pod, metav1.UpdateOptions{})
 		return err
 	})
-	if err != nil {
-		klog.Errorf("can't set label for myself")
-		return
-	}
 }
 
 // DeprecatedPatchPodAnnotationsWithRetry update specific pod annotations
@@ -209,15 +216,3 @@ func GetSpecificAnnotation(pod *v1.Pod, annotationKeys ...string) []string {
 
 	return allAnnoValue
 }
-
-// CheckIfMasterOrControlNode return if node is master or controlPlane
-func CheckIfMasterOrControlNode(clientset *kubernetes.Clientset, nodeName string) bool {
-	node, err := clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
-	if err != nil {
-		klog.Errorf("Error getting node: %v\n", err)
-		return false
-	}
-	_, isMaster := node.Labels["node-role.kubernetes.io/master"]
-	_, isControlPlane := node.Labels["node-role.kubernetes.io/control-plane"]
-	return isMaster || isControlPlane
-}